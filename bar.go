@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// barRetry is the delay before reconnecting to a daemon which went away.
+const barRetry = 2 * time.Second
+
+// block is a status line block of the i3bar protocol.
+type block struct {
+	Name     string `json:"name"`
+	FullText string `json:"full_text"`
+}
+
+// barWriter writes status updates either using the i3bar protocol or as
+// plain lines for a persistent i3blocks block.
+type barWriter struct {
+	w        io.Writer
+	i3blocks bool
+	started  bool
+}
+
+func (b *barWriter) write(text string) error {
+	if b.i3blocks {
+		_, err := fmt.Fprintln(b.w, text)
+		return err
+	}
+
+	if !b.started {
+		if _, err := fmt.Fprintf(b.w, "{\"version\":1,\"click_events\":true}\n[\n"); err != nil {
+			return err
+		}
+		b.started = true
+	}
+
+	line, err := json.Marshal([]block{{Name: "i3-focus-last", FullText: text}})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(b.w, "%s,\n", line)
+	return err
+}
+
+// readClicks calls f for every click event read from r. i3bar sends an
+// endless JSON array with one event per line, i3blocks one event per line.
+func readClicks(r io.Reader, f func()) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if strings.Trim(s.Text(), "[], \t") != "" {
+			f()
+		}
+	}
+
+	return s.Err()
+}
+
+func runBar(args []string) error {
+	fs, o := newFlagSet("bar")
+	format := fs.String("format", "{{.Title}}", "text/template used to show the window switch would focus")
+	i3blocks := fs.Bool("i3blocks", false, "print plain lines for a persistent i3blocks block instead of the i3bar protocol")
+	logLevel := fs.String("log-level", "info", "one of error, warn, info or debug")
+	logFormat := fs.String("log-format", "logfmt", "either logfmt or json")
+	opts := switchFlags(fs)
+	fs.Parse(args)
+	checkArgs(fs, 0, 0)
+
+	tpl, err := template.New("format").Parse(*format)
+	if err != nil {
+		return fmt.Errorf("invalid format: %v", err)
+	}
+
+	// log_level and log_format in the config file are the daemon's
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel)
+	if err != nil {
+		return err
+	}
+
+	addr, err := o.clientAddr(fs)
+	if err != nil {
+		return err
+	}
+
+	switchReq := request{Version: protocolVersion, Command: "switch", Options: opts()}
+
+	// the block shows where a click goes
+	dryRun := request{Version: protocolVersion, Command: "switch", Options: opts()}
+	dryRun.Options["dry-run"] = "true"
+
+	go func() {
+		err := readClicks(os.Stdin, func() {
+			if _, err := remoteRequest(addr, switchReq); err != nil {
+				level.Warn(logger).Log("err", fmt.Errorf("switch failed: %v", err))
+			}
+		})
+		if err != nil {
+			level.Error(logger).Log("err", fmt.Errorf("error reading clicks: %v", err))
+		}
+	}()
+
+	out := &barWriter{w: os.Stdout, i3blocks: *i3blocks}
+
+	update := func() error {
+		raw, err := remoteRequest(addr, dryRun)
+		if err != nil {
+			return err
+		}
+
+		var target *window
+		if err := json.Unmarshal(raw, &target); err != nil {
+			return fmt.Errorf("error unmarshaling window: %v", err)
+		}
+
+		var text bytes.Buffer
+		if target != nil {
+			if err := tpl.Execute(&text, target); err != nil {
+				return err
+			}
+		}
+
+		return out.write(text.String())
+	}
+
+	for {
+		err := update()
+		if err == nil {
+			err = remoteSubscribe(addr, func(notification) error {
+				return update()
+			})
+		}
+		level.Warn(logger).Log("err", err, "retry", barRetry)
+
+		if err := out.write(""); err != nil {
+			return err
+		}
+
+		time.Sleep(barRetry)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBarWriter(t *testing.T) {
+	for _, tc := range []struct {
+		i3blocks bool
+		want     string
+	}{
+		{
+			want: "{\"version\":1,\"click_events\":true}\n[\n" +
+				`[{"name":"i3-focus-last","full_text":"vim"}],` + "\n" +
+				`[{"name":"i3-focus-last","full_text":""}],` + "\n",
+		},
+		{
+			i3blocks: true,
+			want:     "vim\n\n",
+		},
+	} {
+		var buf bytes.Buffer
+		w := &barWriter{w: &buf, i3blocks: tc.i3blocks}
+		w.write("vim")
+		w.write("")
+
+		if got := buf.String(); got != tc.want {
+			t.Errorf("i3blocks=%t: got %q, want %q", tc.i3blocks, got, tc.want)
+		}
+	}
+}
+
+func TestReadClicks(t *testing.T) {
+	in := "[\n{\"name\":\"i3-focus-last\",\"button\":1}\n,{\"name\":\"i3-focus-last\",\"button\":3}\n"
+
+	clicks := 0
+	if err := readClicks(strings.NewReader(in), func() { clicks++ }); err != nil {
+		t.Fatal(err)
+	}
+
+	if clicks != 2 {
+		t.Errorf("got %d clicks, want 2", clicks)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+// version is set at build time with -ldflags "-X main.version=<version>".
+var version = "devel"
+
+type command struct {
+	name     string
+	args     string // positional arguments shown in the usage
+	synopsis string
+	run      func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "daemon", synopsis: "Track focus changes. This is the default if no command is given.", run: runDaemon},
+		{name: "switch", args: "[position]", synopsis: "Focus the previously focused window, or the one at the given history position.", run: runSwitch},
+		{name: "focus", args: "<con_id>", synopsis: "Focus the container with the given ID.", run: runFocus},
+		{name: "raise", args: "[-- command [arguments]]", synopsis: "Focus the most recently used window matching the flags, or run the command if there is none.", run: runRaise},
+		{name: "list", synopsis: "Print the remembered windows, most recently used first.", run: runList},
+		{name: "subscribe", synopsis: "Print a JSON line for every change of the history.", run: runSubscribe},
+		{name: "bar", synopsis: "Show the window switch would focus in i3bar or i3blocks.", run: runBar},
+		{name: "status", synopsis: "Print the state of the daemon.", run: runStatus},
+		{name: "reload", synopsis: "Make the daemon reread its config file.", run: runReload},
+		{name: "quit", synopsis: "Stop the daemon.", run: runQuit},
+		{name: "version", synopsis: "Print the version.", run: runVersion},
+	}
+}
+
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: i3-focus-last [command] [flags] [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.synopsis)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'i3-focus-last <command> -help' for the flags of a command.\n")
+}
+
+// run dispatches to the command named by the first argument. Without a
+// command, or if the first argument is a flag, the daemon is started.
+func run(args []string) error {
+	if len(args) == 0 {
+		return runDaemon(args)
+	}
+
+	switch name := args[0]; {
+	case name == "help" || name == "-h" || name == "-help" || name == "--help":
+		if len(args) > 1 && lookupCommand(args[1]) != nil {
+			return lookupCommand(args[1]).run([]string{"-help"})
+		}
+
+		usage()
+		return nil
+	case strings.HasPrefix(name, "-"):
+		return runDaemon(args)
+	case lookupCommand(name) != nil:
+		return lookupCommand(name).run(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, run 'i3-focus-last help' for a list of commands", name)
+	}
+}
+
+// options are the flags shared by all commands.
+type options struct {
+	configPath    string
+	i3Socket      string
+	socket        string
+	runtimeSocket bool
+}
+
+// newFlagSet returns the flag set of the named command with the shared
+// options registered.
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	cmd := lookupCommand(name)
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+
+	o := &options{}
+	fs.StringVar(&o.configPath, "config", defaultConfigPath(), "path of the config file")
+	fs.StringVar(&o.i3Socket, "i3-socket", "", "i3 IPC socket, defaults to $I3SOCK or i3 --get-socketpath")
+	fs.StringVar(&o.socket, "socket", "", "path of the control socket, overrides the socket derived from the i3 socket")
+	fs.BoolVar(&o.runtimeSocket, "runtime-socket", false, "use a socket in $XDG_RUNTIME_DIR with mode 0600 instead of an abstract socket")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: i3-focus-last %s [flags] %s\n\n%s\n\nflags:\n", name, cmd.args, cmd.synopsis)
+		fs.PrintDefaults()
+	}
+
+	return fs, o
+}
+
+// checkArgs exits with the usage of the command if it got less than min or
+// more than max positional arguments.
+func checkArgs(fs *flag.FlagSet, min, max int) {
+	if n := fs.NArg(); n < min || n > max {
+		fmt.Fprintf(fs.Output(), "%s: wrong number of arguments %q\n", fs.Name(), fs.Args())
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// load reads the config file and applies the shared flags given on the
+// command line on top.
+func (o *options) load(fs *flag.FlagSet) (*config, error) {
+	cfg, err := loadConfig(o.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	o.override(fs, cfg)
+	return cfg, nil
+}
+
+// override applies the shared flags given on the command line to cfg.
+func (o *options) override(fs *flag.FlagSet, cfg *config) {
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "runtime-socket":
+			cfg.RuntimeSocket = o.runtimeSocket
+		case "socket":
+			cfg.Socket = o.socket
+		}
+	})
+}
+
+func (o *options) i3Socketpath() (string, error) {
+	if o.i3Socket != "" {
+		return o.i3Socket, nil
+	}
+
+	return i3.Socketpath()
+}
+
+// addr returns the address of the control socket.
+func (o *options) addr(cfg *config) (*net.UnixAddr, error) {
+	if cfg.Socket != "" {
+		return &net.UnixAddr{Name: os.ExpandEnv(cfg.Socket), Net: "unix"}, nil
+	}
+
+	i3Socket, err := o.i3Socketpath()
+	if err != nil {
+		return nil, fmt.Errorf("error finding i3 socket: %v", err)
+	}
+
+	return socketAddr(i3Socket, cfg.RuntimeSocket)
+}
+
+// clientAddr returns the address of the daemon for commands talking to it.
+func (o *options) clientAddr(fs *flag.FlagSet) (*net.UnixAddr, error) {
+	cfg, err := loadClientConfig(o.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	o.override(fs, cfg)
+	return o.addr(cfg)
+}
+
+func runSwitch(args []string) error {
+	fs, o := newFlagSet("switch")
+	opts := switchFlags(fs)
+	fs.Parse(args)
+	checkArgs(fs, 0, 1)
+
+	addr, err := o.clientAddr(fs)
+	if err != nil {
+		return err
+	}
+
+	_, err = remoteRequest(addr, request{
+		Version: protocolVersion,
+		Command: "switch",
+		Args:    fs.Args(),
+		Options: opts(),
+	})
+	return err
+}
+
+// switchFlags registers the flags of switch, which nop bindings take as
+// well, and returns a function returning their values as request options.
+func switchFlags(fs *flag.FlagSet) func() map[string]string {
+	strategy := fs.String("strategy", "mru", "how to rank the windows: mru, frecency (often and recently focused first) or other-app (skip windows of the focused application)")
+	sameClass := fs.Bool("same-class", false, "only switch to windows with the class of the focused one, cycling through them only if cycle_timeout or cycle_mode is set")
+	preferUrgent := fs.Bool("prefer-urgent", false, "switch to the window which became urgent first, if any")
+
+	return func() map[string]string {
+		return map[string]string{
+			"strategy":      *strategy,
+			"same-class":    strconv.FormatBool(*sameClass),
+			"prefer-urgent": strconv.FormatBool(*preferUrgent),
+		}
+	}
+}
+
+func runFocus(args []string) error {
+	fs, o := newFlagSet("focus")
+	fs.Parse(args)
+	checkArgs(fs, 1, 1)
+
+	addr, err := o.clientAddr(fs)
+	if err != nil {
+		return err
+	}
+
+	_, err = remoteCommand(addr, "focus", fs.Args()...)
+	return err
+}
+
+func runSubscribe(args []string) error {
+	fs, o := newFlagSet("subscribe")
+	fs.Parse(args)
+	checkArgs(fs, 0, 0)
+
+	addr, err := o.clientAddr(fs)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	return remoteSubscribe(addr, func(n notification) error {
+		return enc.Encode(n)
+	})
+}
+
+func runStatus(args []string) error {
+	fs, o := newFlagSet("status")
+	fs.Parse(args)
+	checkArgs(fs, 0, 0)
+
+	addr, err := o.clientAddr(fs)
+	if err != nil {
+		return err
+	}
+
+	raw, err := remoteCommand(addr, "status")
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		return fmt.Errorf("error formatting status: %v", err)
+	}
+
+	_, err = fmt.Printf("%s\n", out.Bytes())
+	return err
+}
+
+func runReload(args []string) error {
+	fs, o := newFlagSet("reload")
+	fs.Parse(args)
+	checkArgs(fs, 0, 0)
+
+	addr, err := o.clientAddr(fs)
+	if err != nil {
+		return err
+	}
+
+	_, err = remoteCommand(addr, "reload")
+	return err
+}
+
+func runQuit(args []string) error {
+	fs, o := newFlagSet("quit")
+	fs.Parse(args)
+	checkArgs(fs, 0, 0)
+
+	addr, err := o.clientAddr(fs)
+	if err != nil {
+		return err
+	}
+
+	_, err = remoteCommand(addr, "quit")
+	return err
+}
+
+func runVersion(args []string) error {
+	fs, _ := newFlagSet("version")
+	fs.Parse(args)
+	checkArgs(fs, 0, 0)
+
+	_, err := fmt.Println("i3-focus-last", version)
+	return err
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/s-urbaniak/i3-focus-last/focus"
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+const (
+	scopeGlobal    = "global"
+	scopeWorkspace = "workspace"
+)
+
+// config is read from config.json in $XDG_CONFIG_HOME/i3-focus-last. Except
+// for connection_timeout and runtime_socket, changes are picked up when the
+// daemon receives SIGHUP.
+type config struct {
+	HistorySize int `json:"history_size"`
+	// Exclude lists windows which never enter history.
+	Exclude []rule `json:"exclude"`
+	// Scope limits switch to windows on the focused workspace if set to "workspace".
+	Scope string `json:"scope"`
+	// CycleTimeout makes repeated switches within the timeout go one window
+	// further back each time instead of toggling between two windows. It is
+	// 0 by default, so switch -same-class needs it, or CycleMode, to get to
+	// more than one other window of the application.
+	CycleTimeout      duration `json:"cycle_timeout"`
+	ConnectionTimeout duration `json:"connection_timeout"`
+	Marks             bool     `json:"marks"`
+	LastMark          string   `json:"last_mark"`
+	RuntimeSocket     bool     `json:"runtime_socket"`
+	// Socket is the path of the control socket. Environment variables in it
+	// are expanded. It takes precedence over runtime_socket.
+	Socket string `json:"socket"`
+	// LogLevel is one of "error", "warn", "info" or "debug". Only debug
+	// logs i3 events, which contain window titles.
+	LogLevel string `json:"log_level"`
+	// LogFormat is either "logfmt" or "json".
+	LogFormat string `json:"log_format"`
+	// FocusDwell is how long focus has to stay on a window before it enters
+	// history, unless it was moved there by a keyboard binding or a switch.
+	FocusDwell duration `json:"focus_dwell"`
+	// HistoryCauses are the causes of focus changes which reorder history:
+	// "keyboard", "mouse", "new" and "switch". All of them if empty.
+	HistoryCauses []string `json:"history_causes"`
+	// CycleMode is the i3 binding mode switch enters to cycle while the
+	// modifier is held.
+	CycleMode string `json:"cycle_mode"`
+}
+
+// rule matches windows by regular expressions. All of the given expressions
+// have to match.
+type rule struct {
+	Class    string `json:"class"`
+	Instance string `json:"instance"`
+	Title    string `json:"title"`
+
+	class, instance, title *regexp.Regexp
+}
+
+// duration is a time.Duration written as a string like "500ms" in JSON.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = duration(v)
+	return nil
+}
+
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+
+	return filepath.Join(dir, "i3-focus-last", "config.json")
+}
+
+func defaultConfig() *config {
+	return &config{
+		HistorySize:       16,
+		Scope:             scopeGlobal,
+		ConnectionTimeout: duration(3 * time.Second),
+		LogLevel:          "info",
+		LogFormat:         "logfmt",
+	}
+}
+
+// loadConfig reads the config file at path on top of the defaults. A missing
+// file is not an error.
+func loadConfig(path string) (*config, error) {
+	cfg := defaultConfig()
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// loadClientConfig reads only the settings clients need to reach the
+// daemon from the config file at path. The others are the daemon's and are
+// neither parsed nor validated, so an invalid one keeps the daemon on its
+// old config without breaking the clients.
+func loadClientConfig(path string) (*config, error) {
+	cfg := defaultConfig()
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var client struct {
+		Socket        string `json:"socket"`
+		RuntimeSocket bool   `json:"runtime_socket"`
+	}
+	if err := json.Unmarshal(b, &client); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	cfg.Socket, cfg.RuntimeSocket = client.Socket, client.RuntimeSocket
+	return cfg, nil
+}
+
+func (cfg *config) validate() error {
+	if cfg.HistorySize < 2 {
+		return fmt.Errorf("history_size must be at least 2, got %d", cfg.HistorySize)
+	}
+
+	if cfg.Scope != scopeGlobal && cfg.Scope != scopeWorkspace {
+		return fmt.Errorf("unknown scope %q", cfg.Scope)
+	}
+
+	if cfg.CycleTimeout < 0 || cfg.FocusDwell < 0 || cfg.ConnectionTimeout <= 0 {
+		return errors.New("timeouts must be positive")
+	}
+
+	if _, err := newLogger(ioutil.Discard, cfg.LogFormat, cfg.LogLevel); err != nil {
+		return err
+	}
+
+	for _, c := range cfg.HistoryCauses {
+		switch c {
+		case focus.CauseKeyboard, focus.CauseMouse, focus.CauseNew, focus.CauseSwitch:
+		default:
+			return fmt.Errorf("unknown history cause %q", c)
+		}
+	}
+
+	if cfg.CycleMode == "default" {
+		return errors.New("cycle_mode must not be the default mode")
+	}
+
+	for i := range cfg.Exclude {
+		if err := cfg.Exclude[i].compile(); err != nil {
+			return fmt.Errorf("exclude rule %d: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// tracker returns the settings of the focus tracker.
+func (cfg *config) tracker() focus.Config {
+	return focus.Config{
+		HistorySize:  cfg.HistorySize,
+		CycleTimeout: time.Duration(cfg.CycleTimeout),
+		Workspace:    cfg.Scope == scopeWorkspace,
+		Marks:        cfg.Marks,
+		LastMark:     cfg.LastMark,
+		Exclude:      cfg.excluded,
+		Dwell:        time.Duration(cfg.FocusDwell),
+		Causes:       cfg.HistoryCauses,
+		CycleMode:    cfg.CycleMode,
+	}
+}
+
+// excluded reports whether n matches any of the exclude rules.
+func (cfg *config) excluded(n *i3.Node) bool {
+	for i := range cfg.Exclude {
+		if cfg.Exclude[i].matches(n) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *rule) compile() error {
+	if r.Class == "" && r.Instance == "" && r.Title == "" {
+		return errors.New("empty rule")
+	}
+
+	for _, p := range []struct {
+		expr string
+		re   **regexp.Regexp
+	}{
+		{r.Class, &r.class},
+		{r.Instance, &r.instance},
+		{r.Title, &r.title},
+	} {
+		if p.expr == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(p.expr)
+		if err != nil {
+			return err
+		}
+		*p.re = re
+	}
+
+	return nil
+}
+
+func (r *rule) matches(n *i3.Node) bool {
+	return (r.class == nil || r.class.MatchString(n.WindowProperties.Class)) &&
+		(r.instance == nil || r.instance.MatchString(n.WindowProperties.Instance)) &&
+		(r.title == nil || r.title.MatchString(n.Name))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i3-focus-last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("missing config file: %v", err)
+	}
+
+	if cfg.HistorySize != 16 || cfg.Scope != scopeGlobal {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+
+	for _, tc := range []struct {
+		content string
+		valid   bool
+	}{
+		{content: `{"history_size": 4, "cycle_timeout": "500ms", "exclude": [{"class": "^Rofi$"}], "history_causes": ["keyboard", "switch"]}`, valid: true},
+		{content: `{"history_size": 1}`},
+		{content: `{"scope": "output"}`},
+		{content: `{"cycle_timeout": "soon"}`},
+		{content: `{"focus_dwell": "-1s"}`},
+		{content: `{"history_causes": ["hover"]}`},
+		{content: `{"cycle_mode": "default"}`},
+		{content: `{"exclude": [{}]}`},
+		{content: `{"exclude": [{"title": "("}]}`},
+		{content: `{"history": 4}`},
+		{content: `{"log_level": "verbose"}`},
+		{content: `{"log_format": "xml"}`},
+	} {
+		if err := ioutil.WriteFile(path, []byte(tc.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := loadConfig(path)
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("%s: got error %v", tc.content, err)
+			continue
+		}
+
+		if !tc.valid {
+			continue
+		}
+
+		if cfg.HistorySize != 4 || time.Duration(cfg.CycleTimeout) != 500*time.Millisecond {
+			t.Errorf("%s: got %+v", tc.content, cfg)
+		}
+
+		rofi := &i3.Node{WindowProperties: i3.WindowProperties{Class: "Rofi"}}
+		if !cfg.excluded(rofi) {
+			t.Errorf("%s: rofi is not excluded", tc.content)
+		}
+
+		if cfg.excluded(&i3.Node{WindowProperties: i3.WindowProperties{Class: "Firefox"}}) {
+			t.Errorf("%s: firefox is excluded", tc.content)
+		}
+	}
+}
+
+func TestLoadClientConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i3-focus-last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+
+	for _, tc := range []struct {
+		content string
+		want    string
+		valid   bool
+	}{
+		{content: `{"history_size": 1, "scope": "output", "socket": "/tmp/focus-last.sock"}`, want: "/tmp/focus-last.sock", valid: true},
+		{content: `{"cycle_timeout": "soon", "log_level": "verbose"}`, valid: true},
+		{content: `{"socket": 1}`},
+		{content: `{`},
+	} {
+		if err := ioutil.WriteFile(path, []byte(tc.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := loadClientConfig(path)
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("%s: got error %v", tc.content, err)
+			continue
+		}
+
+		if tc.valid && cfg.Socket != tc.want {
+			t.Errorf("%s: got socket %q, want %q", tc.content, cfg.Socket, tc.want)
+		}
+	}
+
+	if _, err := loadClientConfig(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("missing config file: %v", err)
+	}
+}
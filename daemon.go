@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/s-urbaniak/i3-focus-last/focus"
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+// daemon owns the history. All of its methods are called from the run loop.
+type daemon struct {
+	cfg  *config
+	load func() (*config, error)
+
+	t *focus.Tracker
+
+	started time.Time
+	// events are the most recent i3 events, oldest first.
+	events              []eventRecord
+	evHealth, cmdHealth *connHealth
+
+	notifier *notifier
+	// watchdog is the interval of systemd watchdog keepalives, 0 if disabled.
+	watchdog time.Duration
+	ready    bool
+
+	b        *broker
+	cmdTaker connTaker
+	// logger is swapped when the config is reloaded.
+	logger *log.SwapLogger
+	// tick fires at tickAt, once the tracker wants to be ticked.
+	tick   <-chan time.Time
+	tickAt time.Time
+}
+
+// run handles events, requests and signals until ctx is done, the daemon is
+// asked to stop by a signal or the event loop fails.
+func (d *daemon) run(ctx context.Context, evChan <-chan event, connChan <-chan struct{}, reqChan <-chan request, errChan <-chan error, sigChan <-chan os.Signal) error {
+	var watchdog <-chan time.Time
+	if d.watchdog > 0 {
+		t := time.NewTicker(d.watchdog)
+		defer t.Stop()
+		watchdog = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err := <-errChan:
+			return err
+
+		case <-watchdog:
+			d.notify(d.notifier.watchdog())
+
+		case <-connChan:
+			if err := d.restore(); err != nil {
+				err = fmt.Errorf("error restoring history: %v", err)
+				level.Error(d.logger).Log("err", err)
+				d.notify(d.notifier.status(err.Error()))
+				continue
+			}
+			d.checkCycleMode()
+
+			// systemd considers the daemon ready once it tracks focus changes
+			status := fmt.Sprintf("connected to i3, %d windows in history", len(d.t.History()))
+			if !d.ready {
+				d.ready = true
+				d.notify(d.notifier.ready(status))
+			} else {
+				d.notify(d.notifier.status(status))
+			}
+
+		case ev := <-evChan:
+			d.handleEvent(ev)
+
+		case <-d.tick:
+			d.tick = nil
+			d.update(d.t.Tick())
+
+		case req := <-reqChan:
+			level.Debug(d.logger).Log("request", req.Command, "args", fmt.Sprint(req.Args))
+
+			// the error is returned to the client, so it is not an error of the daemon
+			result, err := d.handleRequest(req)
+			if err != nil {
+				level.Debug(d.logger).Log("err", fmt.Errorf("%s failed: %v", req.Command, err))
+			}
+
+			req.reply <- reply{result: result, err: err}
+
+		case sig := <-sigChan:
+			switch sig {
+			case syscall.SIGHUP:
+				if err := d.reload(); err != nil {
+					level.Error(d.logger).Log("err", err)
+				}
+			case syscall.SIGUSR1:
+				d.dumpStatus()
+			case syscall.SIGTERM, syscall.SIGINT:
+				level.Info(d.logger).Log("status", "stopping", "signal", sig)
+				return nil
+			}
+		}
+	}
+}
+
+// shutdown writes the marks one last time, so the history can be restored
+// by the next daemon, and closes the command connection.
+func (d *daemon) shutdown() {
+	if err := d.command(d.t.Marks()); err != nil {
+		level.Error(d.logger).Log("err", fmt.Errorf("error writing marks: %v", err))
+	}
+
+	if conn, err := d.cmdTaker(nil); err == nil {
+		conn.Close()
+	}
+}
+
+func (d *daemon) notify(err error) {
+	if err != nil {
+		level.Warn(d.logger).Log("err", fmt.Errorf("error notifying systemd: %v", err))
+	}
+}
+
+// reload rereads the config, keeping the current one if that fails.
+func (d *daemon) reload() error {
+	cfg, err := d.load()
+	if err != nil {
+		return fmt.Errorf("error reloading config, keeping the current one: %v", err)
+	}
+
+	logger, err := newLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("error reloading config, keeping the current one: %v", err)
+	}
+
+	d.cfg = cfg
+	d.t.SetConfig(cfg.tracker())
+	d.logger.Swap(logger)
+	level.Info(d.logger).Log("status", "config reloaded")
+	d.checkCycleMode()
+	return nil
+}
+
+// checkCycleMode reports a cycle mode missing from the i3 config, which i3
+// enters without complaint.
+func (d *daemon) checkCycleMode() {
+	if d.cfg.CycleMode == "" {
+		return
+	}
+
+	var modes []string
+	err := withClient(d.cmdTaker, func(c *i3.Client) (err error) {
+		modes, err = c.BindingModes()
+		return
+	})
+	if err != nil {
+		level.Warn(d.logger).Log("err", fmt.Errorf("error checking cycle_mode: %v", err))
+		return
+	}
+
+	for _, m := range modes {
+		if m == d.cfg.CycleMode {
+			return
+		}
+	}
+
+	level.Error(d.logger).Log("err", fmt.Errorf("cycle_mode %q is not a binding mode of i3, switch will not cycle in it", d.cfg.CycleMode))
+}
+
+// dumpStatus logs the status whatever the log level, since it was asked
+// for. Window titles are left out unless debug logging is enabled.
+func (d *daemon) dumpStatus() {
+	s := d.status()
+	if d.cfg.LogLevel != "debug" {
+		for i := range s.History {
+			s.History[i].Title = ""
+		}
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		level.Error(d.logger).Log("err", fmt.Errorf("error marshaling status: %v", err))
+		return
+	}
+
+	logger, err := newLogger(os.Stderr, d.cfg.LogFormat, "debug")
+	if err != nil {
+		level.Error(d.logger).Log("err", err)
+		return
+	}
+
+	level.Info(logger).Log("status", string(b))
+}
+
+// restore seeds history once the event subscription is (re)established.
+func (d *daemon) restore() error {
+	root, err := d.tree()
+	if err != nil {
+		return err
+	}
+
+	d.publish(d.t.Restore(root))
+	return nil
+}
+
+// handleEvent passes ev to the tracker.
+func (d *daemon) handleEvent(ev event) {
+	level.Debug(d.logger).Log("event", string(ev.payload))
+
+	var u focus.Update
+	switch ev.typ {
+	case i3.EventBinding:
+		var bev i3.BindingEvent
+		if err := json.Unmarshal(ev.payload, &bev); err != nil {
+			level.Warn(d.logger).Log("err", fmt.Errorf("error unmarshaling event: %v", err))
+			return
+		}
+
+		d.recordEvent(ev.typ, bev.Change, &i3.Node{})
+
+		// the nop itself does not change focus, so the tracker never sees it
+		if req, ok, err := parseNop(bev.Binding.Command); ok {
+			if err != nil {
+				level.Warn(d.logger).Log("err", fmt.Errorf("invalid binding %q: %v", bev.Binding.Command, err))
+				return
+			}
+
+			if _, err := d.handleRequest(req); err != nil {
+				level.Debug(d.logger).Log("err", fmt.Errorf("%s failed: %v", req.Command, err))
+			}
+			return
+		}
+
+		u = d.t.Binding(&bev)
+
+	case i3.EventMode:
+		var mev i3.ModeEvent
+		if err := json.Unmarshal(ev.payload, &mev); err != nil {
+			level.Warn(d.logger).Log("err", fmt.Errorf("error unmarshaling event: %v", err))
+			return
+		}
+
+		d.recordEvent(ev.typ, mev.Change, &i3.Node{})
+		u = d.t.Mode(&mev)
+
+	default:
+		var wev i3.WindowEvent
+		if err := json.Unmarshal(ev.payload, &wev); err != nil {
+			level.Warn(d.logger).Log("err", fmt.Errorf("error unmarshaling event: %v", err))
+			return
+		}
+
+		d.recordEvent(ev.typ, wev.Change, &wev.Container)
+
+		if ev.typ == i3.EventShutdown {
+			level.Info(d.logger).Log("status", "i3 is shutting down", "change", wev.Change)
+			return
+		}
+
+		u = d.t.Window(&wev)
+	}
+
+	d.update(u)
+}
+
+// update publishes the change of u and writes the marks.
+func (d *daemon) update(u focus.Update) {
+	d.publish(u)
+
+	if err := d.command(u.Commands); err != nil {
+		level.Error(d.logger).Log("err", fmt.Errorf("error writing marks: %v", err))
+	}
+
+	d.schedule(u.Timeout)
+}
+
+// schedule ticks the tracker after timeout, unless it is 0 or an earlier
+// tick is scheduled already.
+func (d *daemon) schedule(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+
+	at := time.Now().Add(timeout)
+	if d.tick != nil && d.tickAt.Before(at) {
+		return
+	}
+
+	d.tick, d.tickAt = time.After(timeout), at
+}
+
+// command runs cmds as a single i3 command.
+func (d *daemon) command(cmds []string) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	return withClient(d.cmdTaker, func(c *i3.Client) error {
+		return c.Command(strings.Join(cmds, "; "))
+	})
+}
+
+// publish notifies subscribers of the change in u, if any.
+func (d *daemon) publish(u focus.Update) {
+	if u.Change == "" {
+		return
+	}
+
+	d.b.publish(notification{
+		Change:   u.Change,
+		ID:       u.ID,
+		Position: u.Position,
+		History:  d.t.History(),
+	})
+}
+
+func (d *daemon) tree() (*i3.Node, error) {
+	var root *i3.Node
+	err := withClient(d.cmdTaker, func(c *i3.Client) (err error) {
+		root, err = c.Tree()
+		return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tree command failed: %v", err)
+	}
+
+	return root, nil
+}
+
+func (d *daemon) handleRequest(req request) (interface{}, error) {
+	switch req.Command {
+	case "switch":
+		sreq, err := parseSwitch(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if sreq.DryRun {
+			return d.switchTarget(sreq)
+		}
+
+		return nil, d.switchTo(sreq)
+
+	case "focus":
+		id, err := parseConID(req.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, d.command(d.t.Focus(id).Commands)
+
+	case "raise":
+		r, err := parseRaise(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.raise(r)
+
+	case "list":
+		return listWindows(d.t.Windows(), d.cmdTaker)
+
+	case "reload":
+		return nil, d.reload()
+
+	case "status":
+		return d.status(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", req.Command)
+	}
+}
+
+// switchTarget returns the window a switch would focus, nil if there is
+// none.
+func (d *daemon) switchTarget(req focus.SwitchRequest) (*window, error) {
+	root, err := d.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	// the errors only tell why there is no window to go to
+	u, err := d.t.Switch(req, root)
+	if err != nil {
+		return nil, nil
+	}
+
+	w, ok := windows(root)[u.ID]
+	if !ok {
+		return nil, nil
+	}
+
+	return &w, nil
+}
+
+// switchTo hands req to the tracker and focuses the window it picked.
+func (d *daemon) switchTo(req focus.SwitchRequest) error {
+	var root *i3.Node
+	if d.cfg.Scope == scopeWorkspace {
+		var err error
+		if root, err = d.tree(); err != nil {
+			return err
+		}
+	}
+
+	u, err := d.t.Switch(req, root)
+	if err != nil {
+		return err
+	}
+
+	if err := d.command(u.Commands); err != nil {
+		return err
+	}
+
+	d.publish(u)
+	d.schedule(u.Timeout)
+	return nil
+}
@@ -0,0 +1,58 @@
+package focus
+
+// history is a list of container IDs, most recently focused first.
+type history struct {
+	ids  []int
+	size int
+}
+
+func newHistory(size int) *history {
+	return &history{size: size}
+}
+
+// at returns the ID at the given position or -1 if there is none.
+func (h *history) at(i int) int {
+	if i < 0 || i >= len(h.ids) {
+		return -1
+	}
+
+	return h.ids[i]
+}
+
+// push moves id to the front.
+func (h *history) push(id int) {
+	h.remove(id)
+	h.ids = append([]int{id}, h.ids...)
+
+	if len(h.ids) > h.size {
+		h.ids = h.ids[:h.size]
+	}
+}
+
+// remove reports whether id was in history.
+func (h *history) remove(id int) bool {
+	for i := range h.ids {
+		if h.ids[i] == id {
+			h.ids = append(h.ids[:i], h.ids[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *history) reset(ids []int) {
+	h.ids = h.ids[:0]
+	for i := len(ids) - 1; i >= 0; i-- {
+		h.push(ids[i])
+	}
+}
+
+// resize changes the number of remembered windows, dropping the oldest ones
+// if there are too many.
+func (h *history) resize(size int) {
+	h.size = size
+	if len(h.ids) > size {
+		h.ids = h.ids[:size]
+	}
+}
@@ -0,0 +1,32 @@
+package focus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	h := newHistory(3)
+
+	for _, tc := range []struct {
+		op   func()
+		want []int
+	}{
+		{op: func() { h.push(1) }, want: []int{1}},
+		{op: func() { h.push(2) }, want: []int{2, 1}},
+		{op: func() { h.push(1) }, want: []int{1, 2}},
+		{op: func() { h.push(3); h.push(4) }, want: []int{4, 3, 1}},
+		{op: func() { h.remove(3) }, want: []int{4, 1}},
+		{op: func() { h.remove(5) }, want: []int{4, 1}},
+		{op: func() { h.reset([]int{7, 8, 7}) }, want: []int{7, 8}},
+	} {
+		tc.op()
+		if !reflect.DeepEqual(h.ids, tc.want) {
+			t.Errorf("got %v, want %v", h.ids, tc.want)
+		}
+	}
+
+	if id := h.at(2); id != -1 {
+		t.Errorf("got %d at position 2, want -1", id)
+	}
+}
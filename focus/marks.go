@@ -0,0 +1,77 @@
+package focus
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+// Marks starting with an underscore are not shown in window titles by i3.
+const markPrefix = "_focus_last_"
+
+// markCommands marks every container in history with its MRU position,
+// starting at 1 for the focused container.
+func markCommands(h *history) []string {
+	var cmds []string
+	for i, id := range h.ids {
+		cmds = append(cmds, fmt.Sprintf("[con_id=%d] mark --add %s%d", id, markPrefix, i+1))
+	}
+
+	// positions which fell off the end, i.e. after a window was closed
+	for i := len(h.ids); i < h.size; i++ {
+		cmds = append(cmds, fmt.Sprintf("unmark %s%d", markPrefix, i+1))
+	}
+
+	return cmds
+}
+
+// markedIDs returns the container IDs carrying the marks left by
+// markCommands in MRU order. It returns nil if there are none.
+func markedIDs(root *i3.Node) []int {
+	byPos := make(map[int]int)
+	root.Find(func(n *i3.Node) bool {
+		for _, m := range n.Marks {
+			if !strings.HasPrefix(m, markPrefix) {
+				continue
+			}
+
+			pos, err := strconv.Atoi(strings.TrimPrefix(m, markPrefix))
+			if err != nil || pos < 1 {
+				continue
+			}
+
+			byPos[pos] = n.ID
+		}
+		return false
+	})
+
+	if len(byPos) == 0 {
+		return nil
+	}
+
+	positions := make([]int, 0, len(byPos))
+	for pos := range byPos {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+
+	ids := make([]int, len(positions))
+	for i, pos := range positions {
+		ids[i] = byPos[pos]
+	}
+
+	return ids
+}
+
+// lastMarkCommand moves mark to the previously focused container, so it can
+// be used as `[con_mark=<mark>]` in plain i3 commands.
+func lastMarkCommand(mark string, h *history) string {
+	if h.at(1) < 0 {
+		return fmt.Sprintf("unmark %s", mark)
+	}
+
+	return fmt.Sprintf("[con_id=%d] mark --add %s", h.at(1), mark)
+}
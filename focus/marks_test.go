@@ -0,0 +1,67 @@
+package focus
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+func TestMarkCommands(t *testing.T) {
+	for _, tc := range []struct {
+		history []int
+		want    []string
+	}{
+		{want: []string{"unmark _focus_last_1", "unmark _focus_last_2", "unmark _focus_last_3"}},
+		{
+			history: []int{3, 1},
+			want:    []string{"[con_id=3] mark --add _focus_last_1", "[con_id=1] mark --add _focus_last_2", "unmark _focus_last_3"},
+		},
+	} {
+		h := newHistory(3)
+		h.reset(tc.history)
+
+		if got := markCommands(h); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %q, want %q", tc.history, got, tc.want)
+		}
+	}
+}
+
+func TestMarkedIDs(t *testing.T) {
+	for _, tc := range []struct {
+		nodes []i3.Node
+		want  []int
+	}{
+		{nodes: []i3.Node{{ID: 10, Marks: []string{"other"}}}},
+		{
+			nodes: []i3.Node{
+				{ID: 10, Marks: []string{"_focus_last_2", "other"}},
+				{ID: 11, Marks: []string{"_focus_last_x"}},
+				{ID: 12, Marks: []string{"_focus_last_5"}},
+				{ID: 13, FloatingNodes: []i3.Node{{ID: 14, Marks: []string{"_focus_last_1"}}}},
+			},
+			want: []int{14, 10, 12},
+		},
+	} {
+		if got := markedIDs(&i3.Node{ID: 1, Nodes: tc.nodes}); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%+v: got %v, want %v", tc.nodes, got, tc.want)
+		}
+	}
+}
+
+func TestLastMarkCommand(t *testing.T) {
+	for _, tc := range []struct {
+		history []int
+		want    string
+	}{
+		{history: []int{3}, want: "unmark last"},
+		{history: []int{3, 1, 2}, want: "[con_id=1] mark --add last"},
+	} {
+		h := newHistory(3)
+		h.reset(tc.history)
+
+		if got := lastMarkCommand("last", h); got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.history, got, tc.want)
+		}
+	}
+}
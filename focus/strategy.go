@@ -0,0 +1,102 @@
+package focus
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+// maxRecent is the number of focus times kept per window.
+const maxRecent = 10
+
+// Window is what the tracker knows about a window in history.
+type Window struct {
+	ID         int
+	Properties i3.WindowProperties
+	// Cause is what made the window move to the front of history last.
+	Cause string
+	// Focused counts how often the window got focus.
+	Focused int
+	// Recent are the last times the window got focus, oldest first.
+	Recent []time.Time
+}
+
+// Strategy decides which window switch goes to.
+type Strategy interface {
+	// Rank orders the candidates, which are the windows in history other
+	// than the focused one, most recently used first. Candidates left out
+	// are not switched to.
+	Rank(candidates []Window, current Window, now time.Time) []Window
+}
+
+// MRU goes to the most recently used windows first.
+type MRU struct{}
+
+func (MRU) Rank(candidates []Window, _ Window, _ time.Time) []Window {
+	return candidates
+}
+
+// Frecency prefers windows which are focused often. Every focus counts 1
+// and is halved with every HalfLife passed since.
+type Frecency struct {
+	HalfLife time.Duration
+}
+
+func (f Frecency) Rank(candidates []Window, _ Window, now time.Time) []Window {
+	ranked := append([]Window(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return f.score(&ranked[i], now) > f.score(&ranked[j], now)
+	})
+
+	return ranked
+}
+
+// score weights the recent focus times and assumes the older ones to be
+// spread the same way.
+func (f Frecency) score(w *Window, now time.Time) float64 {
+	if len(w.Recent) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, t := range w.Recent {
+		sum += math.Exp2(-float64(now.Sub(t)) / float64(f.HalfLife))
+	}
+
+	return sum / float64(len(w.Recent)) * float64(w.Focused)
+}
+
+// OtherApp goes to the most recently used window of another application,
+// skipping the windows with the same class as the focused one.
+type OtherApp struct{}
+
+func (OtherApp) Rank(candidates []Window, current Window, _ time.Time) []Window {
+	var ranked []Window
+	for _, w := range candidates {
+		if w.Properties.Class != current.Properties.Class {
+			ranked = append(ranked, w)
+		}
+	}
+
+	return ranked
+}
+
+var strategies = map[string]Strategy{
+	"mru":       MRU{},
+	"frecency":  Frecency{HalfLife: time.Hour},
+	"other-app": OtherApp{},
+}
+
+// NewStrategy returns the strategy called name, which is one of "mru",
+// "frecency" or "other-app".
+func NewStrategy(name string) (Strategy, error) {
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+
+	return s, nil
+}
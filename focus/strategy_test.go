@@ -0,0 +1,58 @@
+package focus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+func ids(ws []Window) []int {
+	var ids []int
+	for _, w := range ws {
+		ids = append(ids, w.ID)
+	}
+
+	return ids
+}
+
+func TestStrategies(t *testing.T) {
+	now := time.Unix(10000, 0)
+	ago := func(d time.Duration) time.Time {
+		return now.Add(-d)
+	}
+
+	firefox := i3.WindowProperties{Class: "Firefox"}
+	term := i3.WindowProperties{Class: "URxvt"}
+
+	candidates := []Window{
+		{ID: 1, Properties: term, Focused: 1, Recent: []time.Time{ago(time.Minute)}},
+		{ID: 2, Properties: firefox, Focused: 30, Recent: []time.Time{ago(2 * time.Hour), ago(10 * time.Minute)}},
+		{ID: 3, Properties: term, Focused: 5, Recent: []time.Time{ago(5 * time.Minute)}},
+		{ID: 4, Properties: firefox},
+	}
+	current := Window{ID: 5, Properties: term}
+
+	for _, tc := range []struct {
+		name string
+		want []int
+	}{
+		{name: "mru", want: []int{1, 2, 3, 4}},
+		{name: "frecency", want: []int{2, 3, 1, 4}},
+		{name: "other-app", want: []int{2, 4}},
+	} {
+		s, err := NewStrategy(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := ids(s.Rank(candidates, current, now)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := NewStrategy("lru"); err == nil {
+		t.Error("unknown strategy: got no error")
+	}
+}
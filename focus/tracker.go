@@ -0,0 +1,868 @@
+// Package focus keeps track of the most recently used windows of i3.
+//
+// A Tracker is fed with i3 events and control requests and returns the i3
+// commands to run in response. It does no I/O itself, so the caller is free
+// to run the commands on whatever connection it has.
+package focus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+// Config holds the settings of a Tracker.
+type Config struct {
+	HistorySize int
+	// CycleTimeout makes repeated switches within the timeout go one window
+	// further back each time instead of toggling between two windows.
+	CycleTimeout time.Duration
+	// Workspace limits switching to windows on the focused workspace.
+	Workspace bool
+	// Marks keeps the history in hidden i3 marks, so it can be restored
+	// after i3 restarts.
+	Marks bool
+	// LastMark is kept on the previously focused window if set.
+	LastMark string
+	// Exclude reports whether a window never enters the history.
+	Exclude func(*i3.Node) bool
+	// Dwell is how long focus has to stay on a window before it enters
+	// history, unless a keyboard binding or a switch moved it there.
+	Dwell time.Duration
+	// Causes are the causes of focus changes which move windows to the
+	// front of history, all of them if empty.
+	Causes []string
+	// CycleMode is the i3 binding mode the first switch enters. Further
+	// switches go one window further back each time, and history is only
+	// rewritten once i3 leaves the mode, i.e. when the modifier is released.
+	CycleMode string
+}
+
+// Causes of focus changes.
+const (
+	CauseKeyboard = "keyboard"
+	// CauseMouse is any focus change not caused by one of the others,
+	// i.e. a click or, with focus_follows_mouse, moving the pointer.
+	CauseMouse  = "mouse"
+	CauseNew    = "new"
+	CauseSwitch = "switch"
+)
+
+// maxUrgent is the number of urgent windows remembered.
+const maxUrgent = 8
+
+// bindingLag is the longest time between a focus event and the binding
+// event of the binding which caused it.
+const bindingLag = 100 * time.Millisecond
+
+// modeLag is the longest time between entering the cycle mode and the mode
+// event confirming it.
+const modeLag = 500 * time.Millisecond
+
+// Update tells the caller what to do after an event or request was handled.
+type Update struct {
+	// Commands are the i3 commands to run, in order.
+	Commands []string
+	// Change is one of "focus", "remove", "switch" or "restore" if history
+	// changed or a switch was made, "cycle" if the cycle timeout passed,
+	// "urgent" if a window became urgent or stopped being urgent, empty
+	// otherwise.
+	Change string
+	ID     int
+	// Position is the history position a switch went to.
+	Position int
+	// Timeout asks for a call of Tick once it passed, 0 if not needed. An
+	// earlier Timeout still pending takes precedence, Tick asks for the
+	// later ones again.
+	Timeout time.Duration
+}
+
+// Cycle is the state of consecutive switches within the cycle timeout.
+type Cycle struct {
+	Depth  int
+	Target int
+	At     time.Time
+}
+
+// SwitchRequest asks for a switch to another window.
+type SwitchRequest struct {
+	// Position is the history position to go to, not counting the focused
+	// window. 0 goes to the previous window, or one window further back
+	// each time within the cycle timeout.
+	Position int
+	// Strategy orders the windows to go to, MRU if nil.
+	Strategy Strategy
+	// SameClass limits switching to windows with the class of the focused
+	// one, i.e. the other windows of the same application.
+	SameClass bool
+	// PreferUrgent goes to the window which became urgent first, if any.
+	PreferUrgent bool
+	// DryRun only reports the window the switch would go to, without
+	// focusing it or changing any state.
+	DryRun bool
+}
+
+// Tracker owns the history. It is not safe for concurrent use.
+type Tracker struct {
+	cfg Config
+	now func() time.Time
+
+	h *history
+	// windows holds the windows in history by ID.
+	windows map[int]*Window
+	// current is the focused container, which is not in history if it is
+	// excluded.
+	current Window
+	cycle   Cycle
+	// urgent are the windows with the urgency hint set, oldest first.
+	urgent []int
+	// pending is a focus change waiting for the dwell time to pass.
+	pending *pendingFocus
+	// expected is the window focused by the last switch, whose focus
+	// change enters history right away.
+	expected int
+	// created is the window of the last new event.
+	created int
+	// focusAt is the time of the last focus event.
+	focusAt time.Time
+	// origin is the window focused when the cycle mode was entered, nil
+	// outside of it.
+	origin *Window
+	// modeAt is when the cycle mode was entered, zero once i3 confirmed it.
+	modeAt time.Time
+	// written are the mark commands run last, which need not be repeated.
+	written map[string]bool
+}
+
+type pendingFocus struct {
+	node  i3.Node
+	at    time.Time
+	cause string
+}
+
+// NewTracker returns a Tracker with an empty history. now is used as clock
+// for cycling and the dwell time.
+func NewTracker(cfg Config, now func() time.Time) *Tracker {
+	return &Tracker{
+		cfg:      cfg,
+		now:      now,
+		h:        newHistory(cfg.HistorySize),
+		windows:  make(map[int]*Window),
+		current:  Window{ID: -1},
+		expected: -1,
+		created:  -1,
+	}
+}
+
+// SetConfig replaces the settings, dropping the oldest windows if the
+// history got smaller.
+func (t *Tracker) SetConfig(cfg Config) {
+	t.cfg = cfg
+	t.h.resize(cfg.HistorySize)
+	t.prune()
+	t.written = nil
+}
+
+// Current returns the focused container or -1 if it is not known yet.
+func (t *Tracker) Current() int {
+	return t.current.ID
+}
+
+// History returns a copy of the history, most recently focused first.
+func (t *Tracker) History() []int {
+	return append([]int(nil), t.h.ids...)
+}
+
+// Windows returns what is known about the windows in history, most recently
+// focused first.
+func (t *Tracker) Windows() []Window {
+	windows := make([]Window, len(t.h.ids))
+	for i, id := range t.h.ids {
+		windows[i] = t.window(id)
+	}
+
+	return windows
+}
+
+// Urgent returns the urgent windows, oldest first.
+func (t *Tracker) Urgent() []int {
+	return append([]int(nil), t.urgent...)
+}
+
+// Cycle returns the state of cycling, whose depth is 0 if no cycle is going on.
+func (t *Tracker) Cycle() Cycle {
+	return t.cycle
+}
+
+// Restore seeds history from the tree once the event subscription is
+// (re)established. With marks enabled, history is rebuilt from the marks
+// left on the containers, since container IDs do not survive an i3 restart.
+func (t *Tracker) Restore(root *i3.Node) Update {
+	t.pending = nil
+	t.written = nil
+	// i3 starts in the default mode again
+	t.origin = nil
+	t.modeAt = time.Time{}
+	t.cycle = Cycle{}
+
+	fn := focused(root)
+	if fn != nil {
+		t.current = Window{ID: fn.ID, Properties: fn.WindowProperties}
+	}
+
+	var ids []int
+	if t.cfg.Marks {
+		ids = markedIDs(root)
+	}
+
+	if len(ids) > 0 {
+		t.h.reset(ids)
+	} else if t.h.at(0) < 0 && fn != nil && !t.excluded(fn) {
+		t.h.push(fn.ID)
+	}
+
+	nodes := make(map[int]*i3.Node)
+	var urgent []int
+	root.Find(func(n *i3.Node) bool {
+		nodes[n.ID] = n
+		if n.Urgent {
+			urgent = append(urgent, n.ID)
+		}
+		return false
+	})
+
+	// Windows still urgent keep their place, the tree does not tell since
+	// when the others are.
+	queued := t.urgent
+	t.urgent = nil
+	for _, id := range queued {
+		if n, ok := nodes[id]; ok && n.Urgent {
+			t.setUrgent(id, true)
+		}
+	}
+
+	for _, id := range urgent {
+		t.setUrgent(id, true)
+	}
+
+	// windows restored from marks are only known by the tree
+	windows := make(map[int]*Window)
+	for _, id := range t.h.ids {
+		w, ok := t.windows[id]
+		if !ok {
+			w = &Window{ID: id}
+		}
+
+		if n, ok := nodes[id]; ok {
+			w.Properties = n.WindowProperties
+		}
+
+		windows[id] = w
+	}
+	t.windows = windows
+
+	return Update{Change: "restore"}
+}
+
+// Window handles a window event.
+func (t *Tracker) Window(ev *i3.WindowEvent) Update {
+	id := ev.Container.ID
+
+	switch ev.Change {
+	case "focus":
+		now := t.now()
+
+		// a focus change which waited long enough, but whose timeout did
+		// not pass through Tick yet
+		var u Update
+		if p := t.pending; p != nil && now.Sub(p.at) >= t.wait(p.cause) {
+			u = t.settle(p)
+		}
+		t.pending = nil
+
+		t.current = Window{ID: id, Properties: ev.Container.WindowProperties}
+		t.focusAt = now
+		t.setUrgent(id, false)
+
+		// history waits for the end of the cycle mode
+		if t.origin != nil {
+			t.expected = -1
+			return u
+		}
+
+		if id != t.cycle.Target {
+			t.cycle.Depth = 0
+		}
+
+		if t.excluded(&ev.Container) {
+			t.h.remove(id)
+			delete(t.windows, id)
+			return u
+		}
+
+		// without a binding event, which only follows, it was the mouse
+		cause := CauseMouse
+		switch id {
+		case t.expected:
+			cause = CauseSwitch
+			t.expected = -1
+		case t.created:
+			cause = CauseNew
+			t.created = -1
+		}
+
+		p := &pendingFocus{node: ev.Container, at: now, cause: cause}
+		if wait := t.wait(cause); wait > 0 {
+			t.pending = p
+			u.Timeout = wait
+			return u
+		}
+
+		if su := t.settle(p); su.Change != "" {
+			return su
+		}
+
+		return u
+	case "new":
+		t.created = id
+		return Update{}
+	case "urgent":
+		if !t.setUrgent(id, ev.Container.Urgent) {
+			return Update{}
+		}
+
+		return Update{Change: "urgent", ID: id}
+	case "close":
+		if t.pending != nil && t.pending.node.ID == id {
+			t.pending = nil
+		}
+
+		delete(t.windows, id)
+		urgent := t.setUrgent(id, false)
+		if !t.h.remove(id) {
+			if urgent {
+				return Update{Change: "urgent", ID: id}
+			}
+
+			return Update{}
+		}
+
+		return Update{Commands: t.changedMarks(), Change: "remove", ID: id}
+	default:
+		return Update{}
+	}
+}
+
+// Binding handles a binding event. i3 sends it right after the focus event
+// caused by the binding, which tells focus changes by keyboard from the
+// ones by mouse. The former enter history without waiting for the dwell
+// time. Bindings which cannot move focus, i.e. volume keys, are ignored.
+func (t *Tracker) Binding(ev *i3.BindingEvent) Update {
+	if t.now().Sub(t.focusAt) > bindingLag || !changesFocus(ev.Binding.Command) {
+		return Update{}
+	}
+
+	cause := CauseMouse
+	if ev.Binding.InputType == "keyboard" {
+		cause = CauseKeyboard
+	}
+
+	p := t.pending
+	if p == nil {
+		// it entered history right away
+		if w, ok := t.windows[t.current.ID]; ok && t.h.at(0) == w.ID && w.Cause == CauseMouse {
+			w.Cause = cause
+		}
+
+		return Update{}
+	}
+
+	if p.cause != CauseMouse {
+		return Update{}
+	}
+
+	p.cause = cause
+	if cause != CauseKeyboard {
+		return Update{}
+	}
+
+	t.pending = nil
+	return t.settle(p)
+}
+
+// Mode handles a mode event. Leaving the cycle mode moves the window
+// focused by then to the front of history.
+func (t *Tracker) Mode(ev *i3.ModeEvent) Update {
+	if t.origin == nil {
+		return Update{}
+	}
+
+	if ev.Change == t.cfg.CycleMode {
+		t.modeAt = time.Time{}
+		return Update{}
+	}
+
+	return t.leaveCycleMode()
+}
+
+// leaveCycleMode ends the cycle and moves the focused window to the front
+// of history.
+func (t *Tracker) leaveCycleMode() Update {
+	t.origin = nil
+	t.modeAt = time.Time{}
+	t.cycle = Cycle{}
+
+	n := &i3.Node{ID: t.current.ID, WindowProperties: t.current.Properties}
+	if n.ID < 0 || t.excluded(n) {
+		return Update{}
+	}
+
+	return t.settle(&pendingFocus{node: *n, at: t.now(), cause: CauseSwitch})
+}
+
+// focusCommands are the i3 commands which can move focus.
+var focusCommands = map[string]bool{
+	"focus":      true,
+	"workspace":  true,
+	"scratchpad": true,
+	"kill":       true,
+}
+
+// changesFocus reports whether one of the commands of a binding can move
+// focus.
+func changesFocus(command string) bool {
+	for _, cmd := range strings.FieldsFunc(command, func(r rune) bool { return r == ';' || r == ',' }) {
+		cmd = strings.TrimSpace(cmd)
+
+		// criteria only select the windows the command applies to
+		if strings.HasPrefix(cmd, "[") {
+			if i := strings.Index(cmd, "]"); i >= 0 {
+				cmd = cmd[i+1:]
+			}
+		}
+
+		if words := strings.Fields(cmd); len(words) > 0 && focusCommands[words[0]] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tick lets a pending focus change enter history once it waited long
+// enough and ends the cycle once its timeout passed. It is called after the
+// Timeout of an Update passed.
+func (t *Tracker) Tick() Update {
+	now := t.now()
+
+	var u Update
+	switch p := t.pending; {
+	// i3 switches modes it does not know of without complaint, so the
+	// cycle mode is left if i3 never reported entering it
+	case t.origin != nil && !t.modeAt.IsZero() && now.Sub(t.modeAt) >= modeLag:
+		u = t.leaveCycleMode()
+	case p != nil && now.Sub(p.at) >= t.wait(p.cause):
+		t.pending = nil
+		u = t.settle(p)
+	}
+
+	// the next switch starts over, which changes the window it goes to
+	if t.cfg.CycleMode == "" && t.cycle.Depth > 0 && now.Sub(t.cycle.At) >= t.cfg.CycleTimeout {
+		t.cycle = Cycle{}
+		if u.Change == "" {
+			u.Change = "cycle"
+		}
+	}
+
+	u.Timeout = t.timeout(now)
+	return u
+}
+
+// timeout returns the time until the next call of Tick is needed, 0 if
+// none is.
+func (t *Tracker) timeout(now time.Time) time.Duration {
+	var deadlines []time.Time
+	if p := t.pending; p != nil {
+		deadlines = append(deadlines, p.at.Add(t.wait(p.cause)))
+	}
+
+	if t.origin != nil && !t.modeAt.IsZero() {
+		deadlines = append(deadlines, t.modeAt.Add(modeLag))
+	}
+
+	if t.cfg.CycleMode == "" && t.cycle.Depth > 0 {
+		deadlines = append(deadlines, t.cycle.At.Add(t.cfg.CycleTimeout))
+	}
+
+	var timeout time.Duration
+	for _, d := range deadlines {
+		// a deadline which passed already is due right away
+		left := d.Sub(now)
+		if left <= 0 {
+			left = time.Nanosecond
+		}
+
+		if timeout == 0 || left < timeout {
+			timeout = left
+		}
+	}
+
+	return timeout
+}
+
+// wait returns how long a focus change with the given cause stays pending.
+func (t *Tracker) wait(cause string) time.Duration {
+	switch cause {
+	case CauseKeyboard, CauseSwitch:
+		return 0
+	case CauseMouse:
+		// the binding event may still turn it into a keyboard focus change
+		if t.allowed(CauseKeyboard) != t.allowed(CauseMouse) && t.cfg.Dwell < bindingLag {
+			return bindingLag
+		}
+	}
+
+	return t.cfg.Dwell
+}
+
+func (t *Tracker) allowed(cause string) bool {
+	if len(t.cfg.Causes) == 0 {
+		return true
+	}
+
+	for _, c := range t.cfg.Causes {
+		if c == cause {
+			return true
+		}
+	}
+
+	return false
+}
+
+// settle moves the window of p to the front of history, unless its cause
+// is not allowed to.
+func (t *Tracker) settle(p *pendingFocus) Update {
+	if !t.allowed(p.cause) {
+		return Update{}
+	}
+
+	t.h.push(p.node.ID)
+	t.record(&p.node, p.cause)
+	return Update{Commands: t.changedMarks(), Change: "focus", ID: p.node.ID}
+}
+
+// Marks returns the commands writing the configured marks.
+func (t *Tracker) Marks() []string {
+	var cmds []string
+	if t.cfg.Marks {
+		cmds = append(cmds, markCommands(t.h)...)
+	}
+
+	if t.cfg.LastMark != "" {
+		cmds = append(cmds, lastMarkCommand(t.cfg.LastMark, t.h))
+	}
+
+	return cmds
+}
+
+// changedMarks returns the commands of Marks which differ from the ones run
+// last. Every mark command moves a single mark, so the others stay in
+// place.
+func (t *Tracker) changedMarks() []string {
+	cmds := t.Marks()
+	written := make(map[string]bool, len(cmds))
+
+	var changed []string
+	for _, cmd := range cmds {
+		written[cmd] = true
+		if !t.written[cmd] {
+			changed = append(changed, cmd)
+		}
+	}
+
+	t.written = written
+	return changed
+}
+
+// Focus focuses the container with the given ID.
+func (t *Tracker) Focus(id int) Update {
+	t.expected = id
+	return Update{Commands: []string{focusCommand(id)}}
+}
+
+// ErrNoMatch is returned by Raise if no window matches.
+var ErrNoMatch = errors.New("no matching window")
+
+// Raise focuses the most recently used window in the tree for which match
+// returns true. Windows never focused come last, in tree order. If the best
+// match is focused already, the least recently used one is focused instead,
+// so raising repeatedly cycles through all matches.
+func (t *Tracker) Raise(match func(*i3.Node) bool, root *i3.Node) (Update, error) {
+	var order []int
+	found := make(map[int]bool)
+	root.Find(func(n *i3.Node) bool {
+		// only containers holding a window have a class
+		if n.WindowProperties.Class != "" && match(n) {
+			order = append(order, n.ID)
+			found[n.ID] = true
+		}
+		return false
+	})
+
+	var matches []int
+	for _, id := range t.h.ids {
+		if found[id] {
+			matches = append(matches, id)
+			delete(found, id)
+		}
+	}
+
+	for _, id := range order {
+		if found[id] {
+			matches = append(matches, id)
+		}
+	}
+
+	if len(matches) == 0 {
+		return Update{}, ErrNoMatch
+	}
+
+	id := matches[0]
+	if id == t.current.ID {
+		id = matches[len(matches)-1]
+	}
+	t.expected = id
+
+	return Update{Commands: []string{focusCommand(id)}, ID: id}, nil
+}
+
+// Switch focuses a window from history. root is the current tree, which is
+// only needed if switching is limited to the focused workspace.
+func (t *Tracker) Switch(req SwitchRequest, root *i3.Node) (Update, error) {
+	if req.PreferUrgent && len(t.urgent) > 0 {
+		id := t.urgent[0]
+		if req.DryRun {
+			return Update{ID: id}, nil
+		}
+
+		t.expected = id
+		return Update{Commands: []string{focusCommand(id)}, Change: "switch", ID: id}, nil
+	}
+
+	now := t.now()
+	cycle := req.Position == 0
+
+	// in the cycle mode, positions count from the window the cycle
+	// started on
+	from := t.current
+	if t.origin != nil {
+		from = *t.origin
+	}
+
+	depth := req.Position
+	if cycle {
+		depth = 1
+		switch {
+		case t.origin != nil:
+			depth = t.cycle.Depth + 1
+		case t.cfg.CycleMode == "" && t.cycle.Depth > 0 && now.Sub(t.cycle.At) < t.cfg.CycleTimeout:
+			depth = t.cycle.Depth + 1
+		}
+	}
+
+	strategy := req.Strategy
+	if strategy == nil {
+		strategy = MRU{}
+	}
+
+	targets := t.targets(root, from.ID)
+	if req.SameClass {
+		targets = sameClass(targets, from.Properties.Class)
+	}
+
+	targets = strategy.Rank(targets, from, now)
+	if len(targets) == 0 && req.SameClass {
+		return Update{}, fmt.Errorf("no other %s window to switch to", from.Properties.Class)
+	}
+
+	if len(targets) == 0 {
+		return Update{}, errors.New("no window to switch to")
+	}
+
+	if cycle && depth > len(targets) {
+		depth = 1
+	}
+
+	if depth > len(targets) {
+		return Update{}, fmt.Errorf("no window at position %d", depth)
+	}
+
+	id := targets[depth-1].ID
+	if req.DryRun {
+		return Update{ID: id, Position: depth}, nil
+	}
+
+	t.expected = id
+	if cycle && (t.cfg.CycleTimeout > 0 || t.cfg.CycleMode != "") {
+		t.cycle = Cycle{Depth: depth, Target: id, At: now}
+	}
+
+	u := Update{
+		Commands: []string{focusCommand(id)},
+		Change:   "switch",
+		ID:       id,
+		Position: depth,
+	}
+
+	if cycle && t.cfg.CycleMode != "" && t.origin == nil {
+		t.origin = &from
+		t.modeAt = now
+		u.Commands = append(u.Commands, fmt.Sprintf("mode %q", t.cfg.CycleMode))
+	}
+
+	u.Timeout = t.timeout(now)
+	return u, nil
+}
+
+// targets returns the windows switch can go to from the window with the
+// given ID, most recently used first.
+func (t *Tracker) targets(root *i3.Node, from int) []Window {
+	var ws map[int]string
+	if t.cfg.Workspace && root != nil {
+		ws = workspaces(root)
+	}
+
+	var targets []Window
+	for _, id := range t.h.ids {
+		if id == from {
+			continue
+		}
+
+		if ws != nil && ws[id] != ws[from] {
+			continue
+		}
+
+		targets = append(targets, t.window(id))
+	}
+
+	return targets
+}
+
+// window returns a copy of what is known about the window with the given ID.
+func (t *Tracker) window(id int) Window {
+	if w, ok := t.windows[id]; ok {
+		return *w
+	}
+
+	return Window{ID: id}
+}
+
+// record notes that n got focus.
+func (t *Tracker) record(n *i3.Node, cause string) {
+	w, ok := t.windows[n.ID]
+	if !ok {
+		w = &Window{ID: n.ID}
+		t.windows[n.ID] = w
+	}
+
+	w.Properties = n.WindowProperties
+	w.Cause = cause
+	w.Focused++
+	w.Recent = append(w.Recent, t.now())
+	if len(w.Recent) > maxRecent {
+		w.Recent = w.Recent[len(w.Recent)-maxRecent:]
+	}
+
+	t.prune()
+}
+
+// prune forgets the windows which fell off the end of history.
+func (t *Tracker) prune() {
+	if len(t.windows) <= len(t.h.ids) {
+		return
+	}
+
+	keep := make(map[int]bool, len(t.h.ids))
+	for _, id := range t.h.ids {
+		keep[id] = true
+	}
+
+	for id := range t.windows {
+		if !keep[id] {
+			delete(t.windows, id)
+		}
+	}
+}
+
+// setUrgent queues or dequeues id and reports whether the queue changed.
+func (t *Tracker) setUrgent(id int, urgent bool) bool {
+	for i := range t.urgent {
+		if t.urgent[i] == id {
+			if !urgent {
+				t.urgent = append(t.urgent[:i], t.urgent[i+1:]...)
+			}
+			return !urgent
+		}
+	}
+
+	if urgent && len(t.urgent) < maxUrgent {
+		t.urgent = append(t.urgent, id)
+		return true
+	}
+
+	return false
+}
+
+func sameClass(windows []Window, class string) []Window {
+	var same []Window
+	for _, w := range windows {
+		if w.Properties.Class == class {
+			same = append(same, w)
+		}
+	}
+
+	return same
+}
+
+func (t *Tracker) excluded(n *i3.Node) bool {
+	return t.cfg.Exclude != nil && t.cfg.Exclude(n)
+}
+
+func focusCommand(id int) string {
+	return fmt.Sprintf("[con_id=%d] focus", id)
+}
+
+func focused(root *i3.Node) *i3.Node {
+	return root.Find(func(n *i3.Node) bool {
+		return n.Focused
+	})
+}
+
+// workspaces maps the ID of every container in the tree to the name of its
+// workspace.
+func workspaces(root *i3.Node) map[int]string {
+	ws := make(map[int]string)
+
+	var walk func(n *i3.Node, workspace string)
+	walk = func(n *i3.Node, workspace string) {
+		if n.Type == "workspace" {
+			workspace = n.Name
+		}
+
+		ws[n.ID] = workspace
+
+		for i := range n.Nodes {
+			walk(&n.Nodes[i], workspace)
+		}
+
+		for i := range n.FloatingNodes {
+			walk(&n.FloatingNodes[i], workspace)
+		}
+	}
+
+	walk(root, "")
+	return ws
+}
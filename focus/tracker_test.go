@@ -0,0 +1,984 @@
+package focus
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+type step func(*Tracker, *clock) (Update, error)
+
+func event(change string, n i3.Node) step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Window(&i3.WindowEvent{Change: change, Container: n}), nil
+	}
+}
+
+func focusEv(id int) step {
+	return event("focus", i3.Node{ID: id})
+}
+
+func closeEv(id int) step {
+	return event("close", i3.Node{ID: id})
+}
+
+func restore(root *i3.Node) step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Restore(root), nil
+	}
+}
+
+func switchIn(root *i3.Node, pos int) step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Switch(SwitchRequest{Position: pos}, root)
+	}
+}
+
+func switchTo(pos int) step {
+	return switchIn(nil, pos)
+}
+
+func switchWith(s Strategy) step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Switch(SwitchRequest{Strategy: s}, nil)
+	}
+}
+
+func switchSameClass() step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Switch(SwitchRequest{SameClass: true}, nil)
+	}
+}
+
+func raise(class string, root *i3.Node) step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Raise(func(n *i3.Node) bool {
+			return n.WindowProperties.Class == class
+		}, root)
+	}
+}
+
+func dryRun() step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Switch(SwitchRequest{DryRun: true}, nil)
+	}
+}
+
+func switchUrgent() step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Switch(SwitchRequest{PreferUrgent: true}, nil)
+	}
+}
+
+func urgentEv(id int, urgent bool) step {
+	return event("urgent", i3.Node{ID: id, Urgent: urgent})
+}
+
+func tick() step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Tick(), nil
+	}
+}
+
+func binding(inputType, command string) step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Binding(&i3.BindingEvent{Change: "run", Binding: i3.Binding{Command: command, InputType: inputType}}), nil
+	}
+}
+
+func modeEv(mode string) step {
+	return func(t *Tracker, _ *clock) (Update, error) {
+		return t.Mode(&i3.ModeEvent{Change: mode}), nil
+	}
+}
+
+func focusClass(id int, class string) step {
+	return event("focus", i3.Node{ID: id, WindowProperties: i3.WindowProperties{Class: class}})
+}
+
+func after(d time.Duration) step {
+	return func(_ *Tracker, c *clock) (Update, error) {
+		c.now = c.now.Add(d)
+		return Update{}, nil
+	}
+}
+
+func tree(workspaces ...i3.Node) *i3.Node {
+	return &i3.Node{ID: 1000, Type: "root", Nodes: workspaces}
+}
+
+func workspace(id int, name string, windows ...i3.Node) i3.Node {
+	return i3.Node{ID: id, Type: "workspace", Name: name, Nodes: windows}
+}
+
+func switched(id, pos int) Update {
+	return Update{
+		Commands: []string{fmt.Sprintf("[con_id=%d] focus", id)},
+		Change:   "switch",
+		ID:       id,
+		Position: pos,
+	}
+}
+
+func cycled(id, pos int, timeout time.Duration) Update {
+	u := switched(id, pos)
+	u.Timeout = timeout
+	return u
+}
+
+func TestTracker(t *testing.T) {
+	rofi := i3.Node{ID: 9, WindowProperties: i3.WindowProperties{Class: "Rofi"}}
+	firefox := i3.WindowProperties{Class: "Firefox"}
+	browsers := tree(workspace(101, "1",
+		i3.Node{ID: 1, WindowProperties: firefox},
+		i3.Node{ID: 2, WindowProperties: i3.WindowProperties{Class: "URxvt"}},
+		i3.Node{ID: 3, WindowProperties: firefox},
+		i3.Node{ID: 4, WindowProperties: firefox},
+	))
+	exclude := func(n *i3.Node) bool {
+		return n.WindowProperties.Class == "Rofi"
+	}
+
+	for _, tc := range []struct {
+		name    string
+		cfg     Config
+		steps   []step
+		want    Update
+		err     string
+		history []int
+		current int
+		// causes are checked if set
+		causes []string
+	}{
+		{
+			name:    "focus moves to front",
+			steps:   []step{focusEv(1), focusEv(2), focusEv(3), focusEv(1)},
+			want:    Update{Change: "focus", ID: 1},
+			history: []int{1, 3, 2},
+			current: 1,
+		},
+		{
+			name:    "oldest window is dropped",
+			cfg:     Config{HistorySize: 3},
+			steps:   []step{focusEv(1), focusEv(2), focusEv(3), focusEv(4)},
+			want:    Update{Change: "focus", ID: 4},
+			history: []int{4, 3, 2},
+			current: 4,
+		},
+		{
+			name:    "close removes",
+			steps:   []step{focusEv(1), focusEv(2), closeEv(1)},
+			want:    Update{Change: "remove", ID: 1},
+			history: []int{2},
+			current: 2,
+		},
+		{
+			name:    "move keeps history",
+			steps:   []step{focusEv(1), focusEv(2), event("move", i3.Node{ID: 1})},
+			history: []int{2, 1},
+			current: 2,
+		},
+		{
+			name:    "excluded window",
+			cfg:     Config{Exclude: exclude},
+			steps:   []step{focusEv(1), event("focus", rofi)},
+			history: []int{1},
+			current: 9,
+		},
+		{
+			name:    "switch from excluded window",
+			cfg:     Config{Exclude: exclude},
+			steps:   []step{focusEv(1), focusEv(2), event("focus", rofi), switchTo(0)},
+			want:    switched(2, 1),
+			history: []int{2, 1},
+			current: 9,
+		},
+		{
+			name:    "dry run from excluded window",
+			cfg:     Config{Exclude: exclude},
+			steps:   []step{focusEv(1), focusEv(2), event("focus", rofi), dryRun()},
+			want:    Update{ID: 2, Position: 1},
+			history: []int{2, 1},
+			current: 9,
+		},
+		{
+			name: "dry run goes where the next cycle step goes",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), dryRun(),
+			},
+			want:    Update{ID: 1, Position: 2},
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name: "dry run does not cycle",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), dryRun(), dryRun(), switchTo(0),
+			},
+			want:    cycled(1, 2, time.Second),
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name: "dry run during the dwell time",
+			cfg:  Config{Dwell: time.Second},
+			steps: []step{
+				focusEv(1), after(2 * time.Second), focusEv(2), after(2 * time.Second), tick(),
+				focusEv(3), dryRun(),
+			},
+			want:    Update{ID: 2, Position: 1},
+			history: []int{2, 1},
+			current: 3,
+		},
+		{
+			name:    "switch toggles",
+			steps:   []step{focusEv(1), focusEv(2), switchTo(0), focusEv(1), switchTo(0)},
+			want:    switched(2, 1),
+			history: []int{1, 2},
+			current: 1,
+		},
+		{
+			name:    "switch to position",
+			steps:   []step{focusEv(1), focusEv(2), focusEv(3), switchTo(2)},
+			want:    switched(1, 2),
+			history: []int{3, 2, 1},
+			current: 3,
+		},
+		{
+			name:    "switch to missing position",
+			steps:   []step{focusEv(1), focusEv(2), switchTo(2)},
+			err:     "no window at position 2",
+			history: []int{2, 1},
+			current: 2,
+		},
+		{
+			name:    "switch with empty history",
+			steps:   []step{switchTo(0)},
+			err:     "no window to switch to",
+			current: -1,
+		},
+		{
+			name:    "switch with only the focused window",
+			steps:   []step{focusEv(1), switchTo(0)},
+			err:     "no window to switch to",
+			history: []int{1},
+			current: 1,
+		},
+		{
+			name: "cycling goes further back",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), after(500 * time.Millisecond), switchTo(0),
+			},
+			want:    cycled(1, 2, time.Second),
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name: "cycling wraps around",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), switchTo(0), focusEv(1), switchTo(0),
+			},
+			want:    cycled(2, 1, time.Second),
+			history: []int{1, 2, 3},
+			current: 1,
+		},
+		{
+			name: "cycle times out",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), after(2 * time.Second), switchTo(0),
+			},
+			want:    cycled(3, 1, time.Second),
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name: "focusing another window ends the cycle",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), focusEv(1), switchTo(0),
+			},
+			want:    cycled(2, 1, time.Second),
+			history: []int{1, 2, 3},
+			current: 1,
+		},
+		{
+			name: "explicit position does not cycle",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(2), focusEv(1), switchTo(0),
+			},
+			want:    cycled(3, 1, time.Second),
+			history: []int{1, 3, 2},
+			current: 1,
+		},
+		{
+			name:  "first switch enters the cycle mode",
+			cfg:   Config{CycleMode: "cycle"},
+			steps: []step{focusEv(1), focusEv(2), focusEv(3), switchTo(0)},
+			want: Update{
+				Commands: []string{"[con_id=2] focus", `mode "cycle"`},
+				Change:   "switch",
+				ID:       2,
+				Position: 1,
+				Timeout:  modeLag,
+			},
+			history: []int{3, 2, 1},
+			current: 3,
+		},
+		{
+			name: "confirmed cycle mode is kept",
+			cfg:  Config{CycleMode: "cycle"},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), modeEv("cycle"), after(time.Second), tick(), switchTo(0),
+			},
+			want:    switched(1, 2),
+			history: []int{3, 2, 1},
+			current: 2,
+		},
+		{
+			name: "cycle mode i3 never entered is left",
+			cfg:  Config{CycleMode: "cycle"},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), after(time.Second), tick(),
+			},
+			want:    Update{Change: "focus", ID: 2},
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name: "focus enters history after the cycle mode was left",
+			cfg:  Config{CycleMode: "cycle"},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), after(time.Second), tick(), focusEv(1),
+			},
+			want:    Update{Change: "focus", ID: 1},
+			history: []int{1, 2, 3},
+			current: 1,
+		},
+		{
+			name: "cycle mode goes further back without rewriting history",
+			cfg:  Config{CycleMode: "cycle"},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), modeEv("cycle"), after(5 * time.Second), switchTo(0), focusEv(1),
+			},
+			want:    Update{},
+			history: []int{3, 2, 1},
+			current: 1,
+		},
+		{
+			name: "cycle mode wraps around",
+			cfg:  Config{CycleMode: "cycle"},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), switchTo(0), focusEv(1), switchTo(0),
+			},
+			want:    cycled(2, 1, modeLag),
+			history: []int{3, 2, 1},
+			current: 1,
+		},
+		{
+			name: "leaving the cycle mode commits the selection",
+			cfg:  Config{CycleMode: "cycle"},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), switchTo(0), focusEv(1), modeEv("default"),
+			},
+			want:    Update{Change: "focus", ID: 1},
+			history: []int{1, 3, 2},
+			current: 1,
+			causes:  []string{CauseSwitch, CauseMouse, CauseMouse},
+		},
+		{
+			name: "switch after the cycle mode starts over",
+			cfg:  Config{CycleMode: "cycle"},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), switchTo(0), focusEv(1), modeEv("default"), switchTo(0),
+			},
+			want: Update{
+				Commands: []string{"[con_id=3] focus", `mode "cycle"`},
+				Change:   "switch",
+				ID:       3,
+				Position: 1,
+				Timeout:  modeLag,
+			},
+			history: []int{1, 3, 2},
+			current: 1,
+		},
+		{
+			name: "workspace scope",
+			cfg:  Config{Workspace: true},
+			steps: []step{
+				focusEv(1), focusEv(3), focusEv(2),
+				switchIn(tree(
+					workspace(101, "1", i3.Node{ID: 1}, i3.Node{ID: 2}),
+					workspace(102, "2", i3.Node{ID: 3}),
+				), 0),
+			},
+			want:    switched(1, 1),
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name: "switch to other application",
+			steps: []step{
+				focusClass(1, "Firefox"), focusClass(2, "URxvt"), focusClass(3, "URxvt"),
+				switchWith(OtherApp{}),
+			},
+			want:    switched(1, 1),
+			history: []int{3, 2, 1},
+			current: 3,
+		},
+		{
+			name: "frecency counts focus changes",
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(1), focusEv(2), focusEv(3), focusEv(4),
+				switchWith(Frecency{HalfLife: time.Hour}),
+			},
+			want:    switched(2, 1),
+			history: []int{4, 3, 2, 1},
+			current: 4,
+		},
+		{
+			name: "switch within application",
+			steps: []step{
+				focusClass(1, "URxvt"), focusClass(2, "Firefox"), focusClass(3, "URxvt"),
+				switchSameClass(),
+			},
+			want:    switched(1, 1),
+			history: []int{3, 2, 1},
+			current: 3,
+		},
+		{
+			name: "cycling within application",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusClass(1, "URxvt"), focusClass(2, "Firefox"), focusClass(3, "URxvt"), focusClass(4, "URxvt"),
+				switchSameClass(), focusClass(3, "URxvt"), switchSameClass(), focusClass(1, "URxvt"), switchSameClass(),
+			},
+			want:    cycled(3, 1, time.Second),
+			history: []int{1, 3, 4, 2},
+			current: 1,
+		},
+		{
+			name: "same class toggles without cycle timeout",
+			steps: []step{
+				focusClass(1, "URxvt"), focusClass(2, "Firefox"), focusClass(3, "URxvt"), focusClass(4, "URxvt"),
+				switchSameClass(), focusClass(3, "URxvt"), switchSameClass(),
+			},
+			want:    switched(4, 1),
+			history: []int{3, 4, 2, 1},
+			current: 3,
+		},
+		{
+			name:    "no other window of application",
+			steps:   []step{focusClass(1, "Firefox"), focusClass(2, "URxvt"), switchSameClass()},
+			err:     "no other URxvt window to switch to",
+			history: []int{2, 1},
+			current: 2,
+		},
+		{
+			name:    "raise most recently used match",
+			steps:   []step{focusEv(1), focusEv(3), focusEv(2), raise("Firefox", browsers)},
+			want:    Update{Commands: []string{"[con_id=3] focus"}, ID: 3},
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name:    "raise window never focused",
+			steps:   []step{focusEv(2), raise("Firefox", browsers)},
+			want:    Update{Commands: []string{"[con_id=1] focus"}, ID: 1},
+			history: []int{2},
+			current: 2,
+		},
+		{
+			name:    "raise cycles through matches",
+			steps:   []step{focusEv(1), focusEv(4), focusEv(3), raise("Firefox", browsers)},
+			want:    Update{Commands: []string{"[con_id=1] focus"}, ID: 1},
+			history: []int{3, 4, 1},
+			current: 3,
+		},
+		{
+			name:    "raise without match",
+			steps:   []step{focusEv(2), raise("Chromium", browsers)},
+			err:     ErrNoMatch.Error(),
+			history: []int{2},
+			current: 2,
+		},
+		{
+			name:    "switch to oldest urgent window",
+			steps:   []step{focusEv(1), focusEv(2), urgentEv(5, true), urgentEv(3, true), switchUrgent()},
+			want:    Update{Commands: []string{"[con_id=5] focus"}, Change: "switch", ID: 5},
+			history: []int{2, 1},
+			current: 2,
+		},
+		{
+			name:    "focus clears urgency",
+			steps:   []step{focusEv(1), focusEv(2), urgentEv(5, true), urgentEv(3, true), focusEv(5), switchUrgent()},
+			want:    Update{Commands: []string{"[con_id=3] focus"}, Change: "switch", ID: 3},
+			history: []int{5, 2, 1},
+			current: 5,
+		},
+		{
+			name:    "urgency reset by the window",
+			steps:   []step{focusEv(1), focusEv(2), urgentEv(5, true), urgentEv(5, false), switchUrgent()},
+			want:    switched(1, 1),
+			history: []int{2, 1},
+			current: 2,
+		},
+		{
+			name:    "window becomes urgent",
+			steps:   []step{focusEv(1), urgentEv(5, true)},
+			want:    Update{Change: "urgent", ID: 5},
+			history: []int{1},
+			current: 1,
+		},
+		{
+			name:    "window stays urgent",
+			steps:   []step{focusEv(1), urgentEv(5, true), urgentEv(5, true)},
+			history: []int{1},
+			current: 1,
+		},
+		{
+			name:    "urgent window outside history closes",
+			steps:   []step{focusEv(1), urgentEv(5, true), closeEv(5)},
+			want:    Update{Change: "urgent", ID: 5},
+			history: []int{1},
+			current: 1,
+		},
+		{
+			name:    "closed urgent window",
+			steps:   []step{focusEv(1), focusEv(2), urgentEv(5, true), closeEv(5), switchUrgent()},
+			want:    switched(1, 1),
+			history: []int{2, 1},
+			current: 2,
+		},
+		{
+			name: "restore urgent windows from tree",
+			steps: []step{
+				urgentEv(4, true), urgentEv(3, true),
+				restore(tree(workspace(101, "1",
+					i3.Node{ID: 2, Urgent: true}, i3.Node{ID: 3}, i3.Node{ID: 4, Urgent: true}, i3.Node{ID: 1, Focused: true},
+				))),
+				switchUrgent(),
+			},
+			want:    Update{Commands: []string{"[con_id=4] focus"}, Change: "switch", ID: 4},
+			history: []int{1},
+			current: 1,
+		},
+		{
+			name: "short focus change is ignored",
+			cfg:  Config{Dwell: 300 * time.Millisecond},
+			steps: []step{
+				focusEv(1), after(400 * time.Millisecond),
+				focusEv(2), after(100 * time.Millisecond), focusEv(3),
+			},
+			want:    Update{Timeout: 300 * time.Millisecond},
+			history: []int{1},
+			current: 3,
+		},
+		{
+			name:    "focus change enters history after dwell time",
+			cfg:     Config{Dwell: 300 * time.Millisecond},
+			steps:   []step{focusEv(1), after(300 * time.Millisecond), tick()},
+			want:    Update{Change: "focus", ID: 1},
+			current: 1,
+			history: []int{1},
+		},
+		{
+			name:    "tick before dwell time",
+			cfg:     Config{Dwell: 300 * time.Millisecond},
+			steps:   []step{focusEv(1), after(100 * time.Millisecond), tick()},
+			want:    Update{Timeout: 200 * time.Millisecond},
+			current: 1,
+		},
+		{
+			name: "cycle timeout passes",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), after(time.Second), tick(), dryRun(),
+			},
+			want:    Update{ID: 3, Position: 1},
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name: "tick reports the end of the cycle",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), after(time.Second), tick(),
+			},
+			want:    Update{Change: "cycle"},
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name: "tick before cycle timeout",
+			cfg:  Config{CycleTimeout: time.Second},
+			steps: []step{
+				focusEv(1), focusEv(2), focusEv(3),
+				switchTo(0), focusEv(2), after(400 * time.Millisecond), tick(),
+			},
+			want:    Update{Timeout: 600 * time.Millisecond},
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name:    "keyboard binding skips dwell time",
+			cfg:     Config{Dwell: 300 * time.Millisecond},
+			steps:   []step{focusEv(1), binding("keyboard", "focus left")},
+			want:    Update{Change: "focus", ID: 1},
+			history: []int{1},
+			current: 1,
+		},
+		{
+			name:    "mouse binding does not skip dwell time",
+			cfg:     Config{Dwell: 300 * time.Millisecond},
+			steps:   []step{focusEv(1), binding("mouse", "focus")},
+			current: 1,
+		},
+		{
+			name:    "late keyboard binding",
+			cfg:     Config{Dwell: 300 * time.Millisecond},
+			steps:   []step{focusEv(1), after(200 * time.Millisecond), binding("keyboard", "focus left")},
+			current: 1,
+		},
+		{
+			name: "switch skips dwell time",
+			cfg:  Config{Dwell: 300 * time.Millisecond},
+			steps: []step{
+				focusEv(1), after(time.Second), focusEv(2), after(time.Second), tick(),
+				switchTo(0), focusEv(1),
+			},
+			want:    Update{Change: "focus", ID: 1},
+			history: []int{1, 2},
+			current: 1,
+		},
+		{
+			name: "closed window does not enter history",
+			cfg:  Config{Dwell: 300 * time.Millisecond},
+			steps: []step{
+				focusEv(1), after(time.Second), focusEv(2), closeEv(2), after(time.Second), tick(),
+			},
+			history: []int{1},
+			current: 2,
+		},
+		{
+			name: "causes are recorded",
+			steps: []step{
+				focusEv(1), binding("keyboard", "focus left"),
+				event("new", i3.Node{ID: 2}), focusEv(2),
+				focusEv(3), switchTo(0), focusEv(2), focusEv(3),
+			},
+			want:    Update{Change: "focus", ID: 3},
+			history: []int{3, 2, 1},
+			current: 3,
+			causes:  []string{"mouse", "switch", "keyboard"},
+		},
+		{
+			name:    "new window",
+			steps:   []step{focusEv(1), event("new", i3.Node{ID: 2}), focusEv(2)},
+			want:    Update{Change: "focus", ID: 2},
+			history: []int{2, 1},
+			current: 2,
+			causes:  []string{"new", "mouse"},
+		},
+		{
+			name: "mouse focus does not reorder history",
+			cfg:  Config{Causes: []string{CauseKeyboard, CauseSwitch}},
+			steps: []step{
+				focusEv(1), binding("keyboard", "focus left"), focusEv(2), after(time.Second), tick(),
+			},
+			history: []int{1},
+			current: 2,
+			causes:  []string{"keyboard"},
+		},
+		{
+			name:    "keyboard focus waits for binding event",
+			cfg:     Config{Causes: []string{CauseKeyboard}},
+			steps:   []step{focusEv(1)},
+			want:    Update{Timeout: bindingLag},
+			current: 1,
+		},
+		{
+			name: "binding which cannot move focus",
+			cfg:  Config{Causes: []string{CauseKeyboard, CauseSwitch}},
+			steps: []step{
+				focusEv(1), binding("keyboard", "exec --no-startup-id pactl set-sink-volume 0 +5%"),
+				after(time.Second), tick(),
+			},
+			current: 1,
+		},
+		{
+			name:    "binding with criteria",
+			cfg:     Config{Causes: []string{CauseKeyboard}},
+			steps:   []step{focusEv(1), binding("keyboard", `[class="Firefox"] focus`)},
+			want:    Update{Change: "focus", ID: 1},
+			history: []int{1},
+			current: 1,
+			causes:  []string{"keyboard"},
+		},
+		{
+			name:    "keyboard focus reorders history",
+			cfg:     Config{Causes: []string{CauseKeyboard}},
+			steps:   []step{focusEv(1), binding("keyboard", "focus left")},
+			want:    Update{Change: "focus", ID: 1},
+			history: []int{1},
+			current: 1,
+			causes:  []string{"keyboard"},
+		},
+		{
+			name: "only switches reorder history",
+			cfg:  Config{Causes: []string{CauseSwitch}},
+			steps: []step{
+				restore(tree(workspace(101, "1", i3.Node{ID: 1, Focused: true}, i3.Node{ID: 2}))),
+				focusEv(2), binding("mouse", "focus"), after(time.Second), tick(),
+				switchTo(0), focusEv(1),
+			},
+			want:    Update{Change: "focus", ID: 1},
+			history: []int{1},
+			current: 1,
+			causes:  []string{"switch"},
+		},
+		{
+			name: "windows restored from marks know their class",
+			cfg:  Config{Marks: true},
+			steps: []step{
+				restore(tree(workspace(101, "1",
+					i3.Node{ID: 1, Marks: []string{"_focus_last_3"}, WindowProperties: i3.WindowProperties{Class: "Firefox"}},
+					i3.Node{ID: 2, Marks: []string{"_focus_last_2"}, WindowProperties: i3.WindowProperties{Class: "URxvt"}},
+					i3.Node{ID: 3, Focused: true, Marks: []string{"_focus_last_1"}, WindowProperties: i3.WindowProperties{Class: "URxvt"}},
+				))),
+				switchWith(OtherApp{}),
+			},
+			want:    switched(1, 1),
+			history: []int{3, 2, 1},
+			current: 3,
+		},
+		{
+			name:    "restore seeds the focused window",
+			steps:   []step{restore(tree(workspace(101, "1", i3.Node{ID: 1}, i3.Node{ID: 2, Focused: true})))},
+			want:    Update{Change: "restore"},
+			history: []int{2},
+			current: 2,
+		},
+		{
+			name:    "restore without focused window",
+			steps:   []step{restore(tree())},
+			want:    Update{Change: "restore"},
+			current: -1,
+		},
+		{
+			name:    "restore with excluded focused window",
+			cfg:     Config{Exclude: exclude},
+			steps:   []step{restore(tree(workspace(101, "1", i3.Node{ID: 9, Focused: true, WindowProperties: rofi.WindowProperties})))},
+			want:    Update{Change: "restore"},
+			current: 9,
+		},
+		{
+			name:    "reconnect keeps history",
+			steps:   []step{focusEv(1), focusEv(2), restore(tree(workspace(101, "1", i3.Node{ID: 3, Focused: true})))},
+			want:    Update{Change: "restore"},
+			history: []int{2, 1},
+			current: 3,
+		},
+		{
+			name: "restore from marks",
+			cfg:  Config{Marks: true},
+			steps: []step{restore(tree(workspace(101, "1",
+				i3.Node{ID: 1, Marks: []string{"_focus_last_2", "other"}},
+				i3.Node{ID: 2, Marks: []string{"_focus_last_x"}},
+				i3.Node{ID: 3, Focused: true, Marks: []string{"_focus_last_1"}},
+			)))},
+			want:    Update{Change: "restore"},
+			history: []int{3, 1},
+			current: 3,
+		},
+		{
+			name:    "restore without marks",
+			cfg:     Config{Marks: true},
+			steps:   []step{restore(tree(workspace(101, "1", i3.Node{ID: 1, Focused: true})))},
+			want:    Update{Change: "restore"},
+			history: []int{1},
+			current: 1,
+		},
+		{
+			name:    "close before restore",
+			steps:   []step{closeEv(1)},
+			want:    Update{},
+			current: -1,
+		},
+		{
+			name:    "closing a window never in history changes nothing",
+			cfg:     Config{Marks: true, Exclude: exclude},
+			steps:   []step{focusEv(1), event("focus", rofi), closeEv(9)},
+			want:    Update{},
+			history: []int{1},
+			current: 9,
+		},
+		{
+			name:  "marks are written",
+			cfg:   Config{HistorySize: 3, Marks: true, LastMark: "last"},
+			steps: []step{focusEv(1), focusEv(2)},
+			want: Update{
+				Commands: []string{
+					"[con_id=2] mark --add _focus_last_1",
+					"[con_id=1] mark --add _focus_last_2",
+					"[con_id=1] mark --add last",
+				},
+				Change: "focus",
+				ID:     2,
+			},
+			history: []int{2, 1},
+			current: 2,
+		},
+		{
+			name:  "unchanged marks are not written again",
+			cfg:   Config{HistorySize: 3, Marks: true},
+			steps: []step{focusEv(1), focusEv(2), focusEv(3), focusEv(2)},
+			want: Update{
+				Commands: []string{
+					"[con_id=2] mark --add _focus_last_1",
+					"[con_id=3] mark --add _focus_last_2",
+				},
+				Change: "focus",
+				ID:     2,
+			},
+			history: []int{2, 3, 1},
+			current: 2,
+		},
+		{
+			name: "marks are written again after a restore",
+			cfg:  Config{HistorySize: 2, Marks: true},
+			steps: []step{
+				focusEv(1), focusEv(2),
+				restore(tree(workspace(101, "1", i3.Node{ID: 1}, i3.Node{ID: 2, Focused: true}))),
+				focusEv(2),
+			},
+			want: Update{
+				Commands: []string{
+					"[con_id=2] mark --add _focus_last_1",
+					"[con_id=1] mark --add _focus_last_2",
+				},
+				Change: "focus",
+				ID:     2,
+			},
+			history: []int{2, 1},
+			current: 2,
+		},
+		{
+			name:    "last mark is removed",
+			cfg:     Config{LastMark: "last"},
+			steps:   []step{focusEv(1), focusEv(2), closeEv(1)},
+			want:    Update{Commands: []string{"unmark last"}, Change: "remove", ID: 1},
+			history: []int{2},
+			current: 2,
+		},
+	} {
+		if tc.cfg.HistorySize == 0 {
+			tc.cfg.HistorySize = 16
+		}
+
+		c := &clock{now: time.Unix(0, 0)}
+		tr := NewTracker(tc.cfg, c.Now)
+
+		var (
+			got Update
+			err error
+		)
+		for _, s := range tc.steps {
+			got, err = s(tr, c)
+		}
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+
+		if h := tr.History(); !reflect.DeepEqual(h, tc.history) {
+			t.Errorf("%s: got history %v, want %v", tc.name, h, tc.history)
+		}
+
+		if tc.causes != nil {
+			var causes []string
+			for _, w := range tr.Windows() {
+				causes = append(causes, w.Cause)
+			}
+
+			if !reflect.DeepEqual(causes, tc.causes) {
+				t.Errorf("%s: got causes %v, want %v", tc.name, causes, tc.causes)
+			}
+		}
+
+		if tr.Current() != tc.current {
+			t.Errorf("%s: got current %d, want %d", tc.name, tr.Current(), tc.current)
+		}
+	}
+}
+
+func TestFocus(t *testing.T) {
+	tr := NewTracker(Config{HistorySize: 2}, time.Now)
+
+	want := Update{Commands: []string{"[con_id=7] focus"}}
+	if got := tr.Focus(7); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestChangesFocus(t *testing.T) {
+	for _, tc := range []struct {
+		command string
+		want    bool
+	}{
+		{command: "focus left", want: true},
+		{command: "workspace number 2", want: true},
+		{command: `[con_mark="_last"] focus`, want: true},
+		{command: "move container to workspace 2; workspace 2", want: true},
+		{command: "scratchpad show", want: true},
+		{command: "kill", want: true},
+		{command: "exec --no-startup-id pactl set-sink-volume 0 +5%"},
+		{command: "fullscreen toggle"},
+		{command: "move container to workspace 2"},
+		{command: "mode resize"},
+		{command: `[class="focus"] fullscreen`},
+		{command: ""},
+	} {
+		if got := changesFocus(tc.command); got != tc.want {
+			t.Errorf("%q: got %v, want %v", tc.command, got, tc.want)
+		}
+	}
+}
@@ -1,5 +1,45 @@
 package i3
 
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+type CommandError struct {
+	Command string
+	Err     string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command %q failed: %s", e.Command, e.Err)
+}
+
 func (c Client) Command(s string) error {
-	return c.Write(MsgCommand, []byte(s))
+	err := c.Write(MsgCommand, []byte(s))
+	if err != nil {
+		return errors.Wrap(err, "command request failed")
+	}
+
+	_, rawReply, err := c.Read()
+	if err != nil {
+		return errors.Wrap(err, "command reply read failed")
+	}
+
+	var replies []struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(rawReply, &replies); err != nil {
+		return errors.Wrap(err, "command reply unmarshal failed")
+	}
+
+	for _, r := range replies {
+		if !r.Success {
+			return &CommandError{Command: s, Err: r.Error}
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,76 @@
+package i3
+
+import "fmt"
+
+type EventType uint32
+
+const (
+	EventWorkspace       EventType = 0
+	EventOutput          EventType = 1
+	EventMode            EventType = 2
+	EventWindow          EventType = 3
+	EventBarconfigUpdate EventType = 4
+	EventBinding         EventType = 5
+	EventShutdown        EventType = 6
+	EventTick            EventType = 7
+)
+
+// events have the highest bit of the message type set
+const eventMask MsgType = 1 << 31
+
+func (t MsgType) IsEvent() bool {
+	return t&eventMask != 0
+}
+
+func (t MsgType) Event() EventType {
+	return EventType(t &^ eventMask)
+}
+
+var eventNames = map[EventType]string{
+	EventWorkspace:       "workspace",
+	EventOutput:          "output",
+	EventMode:            "mode",
+	EventWindow:          "window",
+	EventBarconfigUpdate: "barconfig_update",
+	EventBinding:         "binding",
+	EventShutdown:        "shutdown",
+	EventTick:            "tick",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("event(%d)", uint32(t))
+}
+
+// WindowEvent is the payload of window events. Shutdown events only carry
+// the change.
+type WindowEvent struct {
+	Change    string `json:"change"`
+	Container Node   `json:"container"`
+}
+
+// BindingEvent is the payload of binding events. i3 sends it after running
+// the command of the binding.
+type BindingEvent struct {
+	Change  string  `json:"change"`
+	Binding Binding `json:"binding"`
+}
+
+type Binding struct {
+	Command        string   `json:"command"`
+	EventStateMask []string `json:"event_state_mask"`
+	InputCode      int      `json:"input_code"`
+	Symbol         string   `json:"symbol"`
+	// InputType is either "keyboard" or "mouse".
+	InputType string `json:"input_type"`
+}
+
+// ModeEvent is the payload of mode events. Change is the name of the
+// binding mode i3 switched to.
+type ModeEvent struct {
+	Change      string `json:"change"`
+	PangoMarkup bool   `json:"pango_markup"`
+}
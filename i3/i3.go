@@ -3,6 +3,7 @@ package i3
 import (
 	"io"
 	"net"
+	"os"
 	"os/exec"
 	"strings"
 
@@ -12,17 +13,23 @@ import (
 type MsgType uint32
 
 const (
-	MsgCommand    MsgType = 0
-	MsgWorkspaces MsgType = 1
-	MsgSubscribe  MsgType = 2
-	MsgOutputs    MsgType = 3
-	MsgTree       MsgType = 4
-	MsgMarks      MsgType = 5
-	MsgBarConfig  MsgType = 6
-	MsgVersion    MsgType = 7
+	MsgCommand      MsgType = 0
+	MsgWorkspaces   MsgType = 1
+	MsgSubscribe    MsgType = 2
+	MsgOutputs      MsgType = 3
+	MsgTree         MsgType = 4
+	MsgBarConfig    MsgType = 6
+	MsgVersion      MsgType = 7
+	MsgBindingModes MsgType = 8
 )
 
+// Socketpath returns the IPC socket path of the i3 instance this process
+// belongs to. It prefers $I3SOCK, which i3 sets for the processes it starts.
 func Socketpath() (string, error) {
+	if sp := os.Getenv("I3SOCK"); sp != "" {
+		return sp, nil
+	}
+
 	out, err := exec.Command("i3", "--get-socketpath").Output()
 	if err != nil {
 		return "", errors.Wrap(err, "getting socket path from i3 failed")
@@ -87,3 +87,24 @@ func TestTree(t *testing.T) {
 
 	fmt.Printf("%+v\n", root)
 }
+
+func TestCommandReply(t *testing.T) {
+	for _, tc := range []struct {
+		reply string
+		fails bool
+	}{
+		{reply: `[{"success":true}]`},
+		{reply: `[{"success":true},{"success":false,"error":"no such mark"}]`, fails: true},
+	} {
+		var in, out bytes.Buffer
+		if err := i3.NewClient(&in).Write(i3.MsgCommand, []byte(tc.reply)); err != nil {
+			t.Fatal(err)
+		}
+
+		c := i3.NewClient(readWriter{r: &in, w: &out})
+		err := c.Command("focus")
+		if _, ok := err.(*i3.CommandError); ok != tc.fails {
+			t.Errorf("reply %s: unexpected error %v", tc.reply, err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package i3
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// BindingModes returns the names of the binding modes in the i3 config.
+func (c *Client) BindingModes() ([]string, error) {
+	err := c.Write(MsgBindingModes, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "binding modes request failed")
+	}
+
+	_, rawModes, err := c.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "raw binding modes read failed")
+	}
+
+	var modes []string
+	if err := json.Unmarshal(rawModes, &modes); err != nil {
+		return nil, errors.Wrap(err, "binding modes unmarshal failed")
+	}
+
+	return modes, nil
+}
@@ -6,10 +6,39 @@ import (
 	"github.com/pkg/errors"
 )
 
+type WindowProperties struct {
+	Class    string `json:"class"`
+	Instance string `json:"instance"`
+	Title    string `json:"title"`
+}
+
 type Node struct {
-	ID      int    `json:"id"`
-	Focused bool   `json:"focused"`
-	Nodes   []Node `json:"nodes"`
+	ID               int              `json:"id"`
+	Type             string           `json:"type"`
+	Name             string           `json:"name"`
+	Focused          bool             `json:"focused"`
+	Urgent           bool             `json:"urgent"`
+	Marks            []string         `json:"marks"`
+	WindowProperties WindowProperties `json:"window_properties"`
+	Nodes            []Node           `json:"nodes"`
+	FloatingNodes    []Node           `json:"floating_nodes"`
+}
+
+// Find returns the first node in depth-first order for which f returns true.
+func (n *Node) Find(f func(*Node) bool) *Node {
+	if f(n) {
+		return n
+	}
+
+	for _, children := range [][]Node{n.Nodes, n.FloatingNodes} {
+		for i := range children {
+			if found := children[i].Find(f); found != nil {
+				return found
+			}
+		}
+	}
+
+	return nil
 }
 
 func (c *Client) Tree() (*Node, error) {
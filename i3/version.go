@@ -0,0 +1,33 @@
+package i3
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+type Version struct {
+	Major         int    `json:"major"`
+	Minor         int    `json:"minor"`
+	Patch         int    `json:"patch"`
+	HumanReadable string `json:"human_readable"`
+}
+
+func (c *Client) Version() (*Version, error) {
+	err := c.Write(MsgVersion, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "version request failed")
+	}
+
+	_, rawVersion, err := c.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "raw version read failed")
+	}
+
+	var v Version
+	if err := json.Unmarshal(rawVersion, &v); err != nil {
+		return nil, errors.Wrap(err, "version unmarshal failed")
+	}
+
+	return &v, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/s-urbaniak/i3-focus-last/focus"
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+const defaultListFormat = "{{.ID}}\t{{.Workspace}}\t{{.Class}}\t{{.Title}}"
+
+type window struct {
+	ID        int    `json:"con_id"`
+	Workspace string `json:"workspace"`
+	Class     string `json:"class"`
+	Title     string `json:"title"`
+	// Cause is what focused the window last, see the focus package.
+	Cause string `json:"cause,omitempty"`
+}
+
+// windows indexes all containers in the tree by their ID.
+func windows(root *i3.Node) map[int]window {
+	ws := make(map[int]window)
+
+	var walk func(n *i3.Node, workspace string)
+	walk = func(n *i3.Node, workspace string) {
+		if n.Type == "workspace" {
+			workspace = n.Name
+		}
+
+		ws[n.ID] = window{
+			ID:        n.ID,
+			Workspace: workspace,
+			Class:     n.WindowProperties.Class,
+			Title:     n.Name,
+		}
+
+		for i := range n.Nodes {
+			walk(&n.Nodes[i], workspace)
+		}
+
+		for i := range n.FloatingNodes {
+			walk(&n.FloatingNodes[i], workspace)
+		}
+	}
+
+	walk(root, "")
+	return ws
+}
+
+// listWindows returns the windows in history, skipping the ones which are
+// not part of the tree anymore.
+func listWindows(history []focus.Window, take connTaker) ([]window, error) {
+	var root *i3.Node
+	err := withClient(take, func(c *i3.Client) (err error) {
+		root, err = c.Tree()
+		return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tree command failed: %v", err)
+	}
+
+	ws := windows(root)
+	list := make([]window, 0, len(history))
+	for _, h := range history {
+		if w, ok := ws[h.ID]; ok {
+			w.Cause = h.Cause
+			list = append(list, w)
+		}
+	}
+
+	return list, nil
+}
+
+func runList(args []string) error {
+	fs, o := newFlagSet("list")
+	format := fs.String("format", defaultListFormat, "text/template printed for every window")
+	asJSON := fs.Bool("json", false, "print the list as JSON")
+	fs.Parse(args)
+	checkArgs(fs, 0, 0)
+
+	tpl, err := template.New("format").Parse(*format + "\n")
+	if err != nil {
+		return fmt.Errorf("invalid format: %v", err)
+	}
+
+	addr, err := o.clientAddr(fs)
+	if err != nil {
+		return err
+	}
+
+	out, err := remoteCommand(addr, "list")
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		_, err := fmt.Printf("%s\n", out)
+		return err
+	}
+
+	var list []window
+	if err := json.Unmarshal(out, &list); err != nil {
+		return fmt.Errorf("error unmarshaling list: %v", err)
+	}
+
+	for _, w := range list {
+		if err := tpl.Execute(os.Stdout, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
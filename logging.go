@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// newLogger returns a logger writing in the given format, either "logfmt" or
+// "json", which drops everything below the given level.
+func newLogger(w io.Writer, format, lvl string) (log.Logger, error) {
+	var logger log.Logger
+	switch format {
+	case "logfmt":
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(w))
+	case "json":
+		logger = log.NewJSONLogger(log.NewSyncWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	var allow level.Option
+	switch lvl {
+	case "error":
+		allow = level.AllowError()
+	case "warn":
+		allow = level.AllowWarn()
+	case "info":
+		allow = level.AllowInfo()
+	case "debug":
+		allow = level.AllowDebug()
+	default:
+		return nil, fmt.Errorf("unknown log level %q", lvl)
+	}
+
+	return level.NewFilter(logger, allow), nil
+}
@@ -1,32 +1,24 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/go-kit/kit/util/conn"
 	"github.com/pkg/errors"
+	"github.com/s-urbaniak/i3-focus-last/focus"
 	"github.com/s-urbaniak/i3-focus-last/i3"
 )
 
-func focused(root *i3.Node) *i3.Node {
-	if root.Focused {
-		return root
-	}
-
-	for _, node := range root.Nodes {
-		if f := focused(&node); f != nil {
-			return f
-		}
-	}
-
-	return nil
-}
-
 func within(d time.Duration, f func() bool) bool {
 	deadline := time.Now().Add(d)
 	for {
@@ -61,53 +53,114 @@ func newConnTaker(cm *conn.Manager, timeout time.Duration) connTaker {
 	}
 }
 
-func switchWindow(id int, take connTaker) error {
-	conn, err := take(nil)
-	if err != nil {
-		return fmt.Errorf("error taking connection: %v", err)
-	}
+// withClient runs f with a client on the current connection. If f fails for
+// any other reason than i3 rejecting a command, the connection is considered
+// broken and f is retried once on a fresh one.
+func withClient(take connTaker, f func(*i3.Client) error) error {
+	var connErr error
 
-	client := i3.NewClient(conn)
-	if err := client.Command(fmt.Sprintf("[con_id=%d] focus", id)); err != nil {
-		return fmt.Errorf("focus failed", err)
+	for i := 0; i < 2; i++ {
+		conn, err := take(connErr)
+		if err != nil {
+			return fmt.Errorf("error taking connection: %v", err)
+		}
+
+		err = f(i3.NewClient(conn))
+		if _, ok := errors.Cause(err).(*i3.CommandError); err == nil || ok {
+			return err
+		}
+
+		conn.Close()
+		connErr = err
 	}
 
-	return nil
+	return connErr
 }
 
-func evLoop(evChan chan []byte, take connTaker, l log.Logger) {
-	subscribe := func(err error) *i3.Client {
-		conn, err := take(err)
+type event struct {
+	typ     i3.EventType
+	payload []byte
+}
+
+// evLoop forwards the events of the subscribed connection until ctx is done.
+// It reports on connChan whenever the subscription is (re)established and on
+// errChan if it gives up.
+func evLoop(ctx context.Context, evChan chan<- event, connChan chan<- struct{}, errChan chan<- error, take connTaker) {
+	var (
+		mu   sync.Mutex
+		conn net.Conn
+	)
+
+	// closing the connection unblocks the pending read
+	go func() {
+		<-ctx.Done()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	subscribe := func(err error) (*i3.Client, error) {
+		c, err := take(err)
 		if err != nil {
-			l.Log("err", fmt.Errorf("error taking connection: %v", err))
-			os.Exit(1)
+			return nil, fmt.Errorf("error taking connection: %v", err)
 		}
 
-		client := i3.NewClient(conn)
-		if err := client.Subscribe("window"); err != nil {
-			l.Log("err", fmt.Errorf("subscribe failed: %v", err))
-			os.Exit(1)
+		mu.Lock()
+		conn = c
+		mu.Unlock()
+
+		if ctx.Err() != nil {
+			c.Close()
+			return nil, ctx.Err()
 		}
 
-		return client
-	}
+		client := i3.NewClient(c)
+		if err := client.Subscribe("window", "binding", "mode", "shutdown"); err != nil {
+			return nil, fmt.Errorf("subscribe failed: %v", err)
+		}
 
-	client := subscribe(nil)
+		select {
+		case connChan <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 
-	for {
-		_, ev, err := client.Read()
+		return client, nil
+	}
 
-		if err != nil {
-			client = subscribe(fmt.Errorf("error reading event: %v", err))
-		} else {
-			evChan <- ev
+	client, err := subscribe(nil)
+
+	for err == nil {
+		typ, payload, readErr := client.Read()
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case readErr != nil:
+			client, err = subscribe(fmt.Errorf("error reading event: %v", readErr))
+		case typ.IsEvent():
+			select {
+			case evChan <- event{typ: typ.Event(), payload: payload}:
+			case <-ctx.Done():
+				return
+			}
+		default:
+			// some other response, i.e. the subscribe reply
 		}
 	}
+
+	if ctx.Err() == nil {
+		errChan <- err
+	}
 }
 
-func newConnectionManager(logger log.Logger) (*conn.Manager, error) {
+func newConnectionManager(logger log.Logger, i3Socketpath func() (string, error)) (*conn.Manager, error) {
 	dialer := func(_, _ string) (net.Conn, error) {
-		socketpath, err := i3.Socketpath()
+		socketpath, err := i3Socketpath()
 		if err != nil {
 			return nil, fmt.Errorf("error creating socketpath: %v", err)
 		}
@@ -118,96 +171,164 @@ func newConnectionManager(logger log.Logger) (*conn.Manager, error) {
 	return conn.NewManager(dialer, "", "", time.After, log.With(logger, "component", "manager")), nil
 }
 
-func main() {
-	w := log.NewSyncWriter(os.Stderr)
-	logger := log.NewLogfmtLogger(w)
-
-	if len(os.Args) > 1 && os.Args[1] == "switch" {
-		if err := remoteSwitch(); err != nil {
-			logger.Log("err", fmt.Errorf("error switching: %v", err))
-			os.Exit(1)
+func runDaemon(args []string) error {
+	fs, o := newFlagSet("daemon")
+	useMarks := fs.Bool("marks", false, "keep history in hidden i3 marks so it survives i3 restarts")
+	lastMark := fs.String("last-mark", "", "keep this i3 mark on the previously focused window")
+	historySize := fs.Int("history-size", 16, "number of windows to remember")
+	logLevel := fs.String("log-level", "info", "one of error, warn, info or debug, which logs i3 events including window titles")
+	logFormat := fs.String("log-format", "logfmt", "either logfmt or json")
+	fs.Parse(args)
+	checkArgs(fs, 0, 0)
+
+	// flags given on the command line take precedence over the config file
+	load := func() (*config, error) {
+		cfg, err := o.load(fs)
+		if err != nil {
+			return nil, err
 		}
 
-		os.Exit(0)
-	}
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "marks":
+				cfg.Marks = *useMarks
+			case "last-mark":
+				cfg.LastMark = *lastMark
+			case "history-size":
+				cfg.HistorySize = *historySize
+			case "log-level":
+				cfg.LogLevel = *logLevel
+			case "log-format":
+				cfg.LogFormat = *logFormat
+			}
+		})
 
-	switchChan := make(chan struct{})
-	switchFn := func() { switchChan <- struct{}{} }
+		return cfg, cfg.validate()
+	}
 
-	go func() {
-		if err := startServer(switchFn); err != nil {
-			logger.Log("err", fmt.Errorf("error starting server: %v", err))
-			os.Exit(1)
-		}
-	}()
+	cfg, err := load()
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
 
-	cm, err := newConnectionManager(logger)
+	var logger log.SwapLogger
+	l, err := newLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel)
 	if err != nil {
-		logger.Log("err", fmt.Errorf("error creating connection manager: %v", err))
-		os.Exit(1)
+		return err
 	}
+	logger.Swap(l)
 
-	taker := newConnTaker(cm, 3*time.Second)
+	addr, err := o.addr(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating socket address: %v", err)
+	}
 
-	conn, err := taker(nil)
+	// With socket activation, systemd owns the socket and queues the requests
+	// arriving while the daemon is (re)started.
+	listener, err := activationListener()
 	if err != nil {
-		logger.Log("err", fmt.Errorf("error taking connection: %v", err))
-		os.Exit(1)
+		return fmt.Errorf("error using socket from systemd: %v", err)
+	}
+
+	if listener == nil {
+		listener, err = listen(addr)
+		if err != nil {
+			return fmt.Errorf("error starting server: %v", err)
+		}
+	}
+
+	// ctx is done once the daemon is stopped by a quit request or a signal
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reqChan := make(chan request)
+
+	srv := &server{
+		reqChan: reqChan,
+		b:       newBroker(),
+		logger:  &logger,
+		quit:    cancel,
+	}
+	go srv.serve(ctx, listener)
+
+	// Commands get a connection of their own, so their replies do not
+	// interleave with the events on the subscribed connection.
+	newTaker := func(component string) (connTaker, error) {
+		cm, err := newConnectionManager(level.Warn(log.With(&logger, "conn", component)), o.i3Socketpath)
+		if err != nil {
+			return nil, fmt.Errorf("error creating connection manager: %v", err)
+		}
+
+		return newConnTaker(cm, time.Duration(cfg.ConnectionTimeout)), nil
 	}
 
-	i3c := i3.NewClient(conn)
-	root, err := i3c.Tree()
+	evTaker, err := newTaker("events")
 	if err != nil {
-		logger.Log("err", fmt.Errorf("tree command failed: %v", err))
-		os.Exit(1)
+		return err
 	}
 
-	history := []int{-1, -1}
-	if fn := focused(root); fn != nil {
-		history[1] = fn.ID
+	cmdTaker, err := newTaker("commands")
+	if err != nil {
+		return err
 	}
 
-	evChan := make(chan []byte)
-	go evLoop(evChan, taker, logger)
+	watchdog, err := watchdogInterval()
+	if err != nil {
+		return err
+	}
 
-	logger.Log("status", "i3-focus-last started")
+	evHealth, cmdHealth := &connHealth{}, &connHealth{}
+	evTaker, cmdTaker = evHealth.wrap(evTaker), cmdHealth.wrap(cmdTaker)
+
+	d := &daemon{
+		cfg:       cfg,
+		load:      load,
+		t:         focus.NewTracker(cfg.tracker(), time.Now),
+		started:   time.Now(),
+		evHealth:  evHealth,
+		cmdHealth: cmdHealth,
+		notifier:  newNotifier(),
+		watchdog:  watchdog,
+		b:         srv.b,
+		cmdTaker:  cmdTaker,
+		logger:    &logger,
+	}
 
-	for {
-		select {
-		case ev := <-evChan:
-			logger.Log("event", string(ev))
+	// systemd shows the state until the connection is back
+	evHealth.lost = func(err error) {
+		d.notify(d.notifier.status(fmt.Sprintf("reconnecting to i3: %v", err)))
+	}
 
-			if len(ev) == 0 || ev[0] == '[' {
-				continue // some other response, not a JSON object
-			}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGTERM, syscall.SIGINT)
 
-			evJson := struct {
-				Change    string `json:"change"`
-				Container struct {
-					ID int `json:"id"`
-				} `json:"container"`
-			}{}
+	evChan := make(chan event)
+	connChan := make(chan struct{})
+	errChan := make(chan error, 1)
+	go evLoop(ctx, evChan, connChan, errChan, evTaker)
 
-			if err := json.Unmarshal(ev, &evJson); err != nil {
-				logger.Log("err", fmt.Errorf("error unmarshaling event: %v", err))
-				continue
-			}
+	level.Info(&logger).Log("status", "i3-focus-last started")
+	err = d.run(ctx, evChan, connChan, reqChan, errChan, sigChan)
 
-			if evJson.Change != "focus" {
-				continue
-			}
+	// Stop accepting requests and wait for the ones in flight to be answered,
+	// before the last state is written and the i3 connection is closed.
+	cancel()
+	d.notify(d.notifier.stopping())
+	srv.wait()
+	d.shutdown()
 
-			history[0], history[1] = history[1], evJson.Container.ID
+	if err != nil {
+		return err
+	}
 
-		case <-switchChan:
-			if history[0] < 0 {
-				continue
-			}
+	level.Info(&logger).Log("status", "i3-focus-last stopped")
+	return nil
+}
 
-			if err := switchWindow(history[0], taker); err != nil {
-				logger.Log("err", fmt.Errorf("focus command failed: %v", err))
-				os.Exit(1)
-			}
-		}
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+		logger.Log("err", err)
+		os.Exit(1)
 	}
 }
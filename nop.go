@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+)
+
+// nopPrefix starts the nop commands which the daemon runs itself when it
+// sees their binding event, as in `bindsym $mod+Tab nop focus-last switch`.
+const nopPrefix = "focus-last"
+
+// parseNop returns the request of the first `nop focus-last <command>` in
+// the command of a binding. The arguments are the ones of the command line,
+// but only switch takes flags.
+func parseNop(command string) (req request, ok bool, err error) {
+	for _, cmd := range strings.FieldsFunc(command, func(r rune) bool { return r == ';' || r == ',' }) {
+		words := strings.Fields(cmd)
+		if len(words) < 3 || words[0] != "nop" || words[1] != nopPrefix {
+			continue
+		}
+
+		req = request{Version: protocolVersion, Command: words[2], Args: words[3:]}
+		if req.Command != "switch" {
+			return req, true, nil
+		}
+
+		fs := flag.NewFlagSet(req.Command, flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		opts := switchFlags(fs)
+		if err := fs.Parse(req.Args); err != nil {
+			return req, true, err
+		}
+
+		req.Args, req.Options = fs.Args(), opts()
+		return req, true, nil
+	}
+
+	return request{}, false, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNop(t *testing.T) {
+	for _, tc := range []struct {
+		command string
+		ok      bool
+		want    request
+		err     bool
+	}{
+		{command: "focus left"},
+		{command: "nop"},
+		{command: "nop focus-last"},
+		{command: "nop other switch"},
+		{
+			command: "nop focus-last switch",
+			ok:      true,
+			want: request{Command: "switch", Args: []string{}, Options: map[string]string{
+				"strategy": "mru", "same-class": "false", "prefer-urgent": "false",
+			}},
+		},
+		{
+			command: "mode default; nop focus-last switch -strategy frecency -same-class 2",
+			ok:      true,
+			want: request{Command: "switch", Args: []string{"2"}, Options: map[string]string{
+				"strategy": "frecency", "same-class": "true", "prefer-urgent": "false",
+			}},
+		},
+		{command: "nop focus-last focus 94", ok: true, want: request{Command: "focus", Args: []string{"94"}}},
+		{command: "nop focus-last switch -hold", ok: true, err: true},
+	} {
+		req, ok, err := parseNop(tc.command)
+		if ok != tc.ok || (err != nil) != tc.err {
+			t.Errorf("%s: got ok %v, error %v", tc.command, ok, err)
+			continue
+		}
+
+		if !ok || err != nil {
+			continue
+		}
+
+		tc.want.Version = protocolVersion
+		if !reflect.DeepEqual(req, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.command, req, tc.want)
+		}
+	}
+}
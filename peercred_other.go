@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "net"
+
+// peerUID is not available without SO_PEERCRED. Abstract sockets are
+// Linux-only as well, so the filesystem socket's mode is the only protection.
+func peerUID(conn *net.UnixConn) (int, error) {
+	return -1, errNoPeerCred
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/s-urbaniak/i3-focus-last/focus"
+)
+
+// raiseResult is the result of a raise request.
+type raiseResult struct {
+	Found bool `json:"found"`
+	ID    int  `json:"con_id,omitempty"`
+}
+
+// parseRaise returns the rule for the windows a raise request asks for.
+func parseRaise(req request) (*rule, error) {
+	if len(req.Args) > 0 {
+		return nil, fmt.Errorf("unexpected arguments %q", req.Args)
+	}
+
+	r := &rule{}
+	for name, value := range req.Options {
+		switch name {
+		case "class":
+			r.Class = value
+		case "instance":
+			r.Instance = value
+		case "title":
+			r.Title = value
+		default:
+			return nil, fmt.Errorf("unknown option %q", name)
+		}
+	}
+
+	if err := r.compile(); err != nil {
+		return nil, fmt.Errorf("invalid criteria: %v", err)
+	}
+
+	return r, nil
+}
+
+// raise focuses the most recently used window matching r.
+func (d *daemon) raise(r *rule) (raiseResult, error) {
+	root, err := d.tree()
+	if err != nil {
+		return raiseResult{}, err
+	}
+
+	u, err := d.t.Raise(r.matches, root)
+	if err == focus.ErrNoMatch {
+		return raiseResult{}, nil
+	}
+	if err != nil {
+		return raiseResult{}, err
+	}
+
+	if err := d.command(u.Commands); err != nil {
+		return raiseResult{}, err
+	}
+
+	return raiseResult{Found: true, ID: u.ID}, nil
+}
+
+func runRaise(args []string) error {
+	fs, o := newFlagSet("raise")
+	class := fs.String("class", "", "regular expression matching the window class")
+	instance := fs.String("instance", "", "regular expression matching the window instance")
+	title := fs.String("title", "", "regular expression matching the window title")
+	fs.Parse(args)
+
+	addr, err := o.clientAddr(fs)
+	if err != nil {
+		return err
+	}
+
+	opts := make(map[string]string)
+	for name, value := range map[string]string{"class": *class, "instance": *instance, "title": *title} {
+		if value != "" {
+			opts[name] = value
+		}
+	}
+
+	out, err := remoteRequest(addr, request{Version: protocolVersion, Command: "raise", Options: opts})
+	if err != nil {
+		return err
+	}
+
+	var res raiseResult
+	if err := json.Unmarshal(out, &res); err != nil {
+		return fmt.Errorf("error unmarshaling result: %v", err)
+	}
+
+	if res.Found {
+		return nil
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("no matching window")
+	}
+
+	// the command takes over this process, which i3 started with the
+	// environment the command expects
+	path, err := exec.LookPath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(path, fs.Args(), os.Environ())
+}
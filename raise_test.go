@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+func TestParseRaise(t *testing.T) {
+	for _, tc := range []struct {
+		req   request
+		match bool
+		err   string
+	}{
+		{req: request{Options: map[string]string{"class": "^Firefox$"}}, match: true},
+		{req: request{Options: map[string]string{"class": "^Firefox$", "title": "mail"}}},
+		{req: request{}, err: "invalid criteria: empty rule"},
+		{req: request{Args: []string{"firefox"}}, err: `unexpected arguments ["firefox"]`},
+		{req: request{Options: map[string]string{"role": "browser"}}, err: `unknown option "role"`},
+	} {
+		r, err := parseRaise(tc.req)
+		switch {
+		case tc.err != "":
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%+v: got error %v, want %q", tc.req, err, tc.err)
+			}
+		case err != nil:
+			t.Errorf("%+v: unexpected error %v", tc.req, err)
+		default:
+			n := &i3.Node{Name: "news", WindowProperties: i3.WindowProperties{Class: "Firefox"}}
+			if got := r.matches(n); got != tc.match {
+				t.Errorf("%+v: got match %v, want %v", tc.req, got, tc.match)
+			}
+		}
+	}
+}
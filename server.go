@@ -1,63 +1,399 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
+	"hash/fnv"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/s-urbaniak/i3-focus-last/focus"
+)
+
+// protocolVersion is bumped on incompatible changes of request or response.
+const protocolVersion = 1
+
+const (
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+// request is a single line on the control socket. The handler sends exactly
+// one reply for it.
+type request struct {
+	Version int      `json:"version"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// Options are named options of the command, i.e. the strategy of switch.
+	Options map[string]string `json:"options,omitempty"`
+
+	reply chan<- reply
+}
+
+type reply struct {
+	result interface{}
+	err    error
+}
+
+// response is the line written back for every request.
+type response struct {
+	Version int             `json:"version"`
+	Status  string          `json:"status"`
+	Error   string          `json:"error,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+// Both socket names contain a hash of the i3 socket path, so every i3
+// instance, i.e. a nested one in Xephyr, gets a daemon of its own.
+const (
+	socketTpl        = "\x00i3-focus-last/%d/%s"
+	runtimeSocketTpl = "i3-focus-last.%s.sock"
 )
 
-type switchFunc func()
+// maxRequestSize limits the length of a request line.
+const maxRequestSize = 4096
+
+// shutdownWriteTimeout is how long writes to clients may take once the
+// daemon is shutting down.
+const shutdownWriteTimeout = time.Second
 
-const socketTpl = "\x00i3-focus-last/%d"
+var errNoPeerCred = errors.New("peer credentials not supported")
 
-func startServer(sf switchFunc) error {
-	l, err := net.ListenUnix("unix", &net.UnixAddr{
-		Name: fmt.Sprintf(socketTpl, os.Getuid()),
+// socketAddr returns the address of the control socket belonging to the i3
+// instance listening on i3Socket. By default it is an abstract socket, which
+// has no permissions of its own. With runtimeDir it is a filesystem socket in
+// $XDG_RUNTIME_DIR.
+func socketAddr(i3Socket string, runtimeDir bool) (*net.UnixAddr, error) {
+	hash := fnv.New64a()
+	hash.Write([]byte(i3Socket))
+	instance := fmt.Sprintf("%x", hash.Sum64())
+
+	if !runtimeDir {
+		return &net.UnixAddr{
+			Name: fmt.Sprintf(socketTpl, os.Getuid(), instance),
+			Net:  "unix",
+		}, nil
+	}
+
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return nil, errors.New("XDG_RUNTIME_DIR is not set")
+	}
+
+	return &net.UnixAddr{
+		Name: filepath.Join(dir, fmt.Sprintf(runtimeSocketTpl, instance)),
 		Net:  "unix",
-	})
+	}, nil
+}
+
+var errShuttingDown = errors.New("daemon is shutting down")
+
+var errAlreadyRunning = errors.New("a daemon is already running for this i3 instance, stop it with 'i3-focus-last quit'")
+
+// listen refuses to start a second daemon on addr.
+func listen(addr *net.UnixAddr) (*net.UnixListener, error) {
+	if conn, err := net.DialUnix("unix", nil, addr); err == nil {
+		conn.Close()
+		return nil, errAlreadyRunning
+	}
+
+	if strings.HasPrefix(addr.Name, "\x00") {
+		return net.ListenUnix("unix", addr)
+	}
+
+	// A socket file left behind by a daemon which was killed is removed, as
+	// nobody answers on it anymore.
+	if err := os.Remove(addr.Name); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
 
+	l, err := net.ListenUnix("unix", addr)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	if err := os.Chmod(addr.Name, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// checkPeer rejects connections from processes of other users.
+func checkPeer(conn *net.UnixConn) error {
+	uid, err := peerUID(conn)
+	switch {
+	case err == errNoPeerCred:
+		return nil
+	case err != nil:
+		return fmt.Errorf("error reading peer credentials: %v", err)
+	case uid != os.Getuid():
+		return fmt.Errorf("rejected connection from uid %d", uid)
+	}
+
+	return nil
+}
+
+type server struct {
+	reqChan chan<- request
+	b       *broker
+	logger  log.Logger
+	// quit is called after the response to a quit request was written.
+	quit func()
+
+	wg sync.WaitGroup
+}
+
+// serve accepts connections on l until ctx is done.
+func (srv *server) serve(ctx context.Context, l *net.UnixListener) {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
 	for {
-		func() {
-			conn, err := l.AcceptUnix()
-			if err != nil {
-				log.Println(err)
-				return
+		conn, err := l.AcceptUnix()
+		if ctx.Err() != nil {
+			if conn != nil {
+				conn.Close()
 			}
-			defer conn.Close()
+			return
+		}
 
-			b, err := ioutil.ReadAll(io.LimitReader(conn, 1))
-			if b[0] != 's' {
-				log.Println("invalid command")
-				return
-			}
+		if err != nil {
+			level.Error(srv.logger).Log("err", err)
+			continue
+		}
 
-			sf()
+		if err := checkPeer(conn); err != nil {
+			level.Warn(srv.logger).Log("err", err)
+			conn.Close()
+			continue
+		}
+
+		srv.wg.Add(1)
+		go func() {
+			defer srv.wg.Done()
+			srv.handle(ctx, conn)
 		}()
 	}
 }
 
-func remoteSwitch() error {
-	addr := net.UnixAddr{
-		Name: fmt.Sprintf(socketTpl, os.Getuid()),
-		Net:  "unix",
+// wait blocks until all connections have been handled.
+func (srv *server) wait() {
+	srv.wg.Wait()
+}
+
+// handle answers requests on conn until the client closes it or ctx is done.
+// A subscribe request turns the connection into a stream of notifications.
+func (srv *server) handle(ctx context.Context, conn *net.UnixConn) {
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// Reads are interrupted right away, but the response to a request in
+	// flight still gets written, unless the client does not read it.
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+			conn.SetWriteDeadline(time.Now().Add(shutdownWriteTimeout))
+		case <-done:
+		}
+	}()
+
+	s := bufio.NewScanner(conn)
+	s.Buffer(make([]byte, 0, maxRequestSize), maxRequestSize)
+	enc := json.NewEncoder(conn)
+
+	for s.Scan() {
+		req, err := parseRequest(s.Bytes())
+
+		var resp response
+		switch {
+		case err != nil:
+			resp = errorResponse(err)
+		case req.Command == "subscribe":
+			if err := stream(ctx, conn, srv.b); err != nil {
+				level.Debug(srv.logger).Log("status", "subscriber gone", "err", err)
+			}
+			return
+		case req.Command == "quit":
+			if err := enc.Encode(response{Version: protocolVersion, Status: statusOK}); err != nil {
+				level.Debug(srv.logger).Log("err", err)
+			}
+			srv.quit()
+			return
+		default:
+			resp = call(ctx, req, srv.reqChan)
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			level.Debug(srv.logger).Log("err", err)
+			return
+		}
 	}
 
-	conn, err := net.DialUnix("unix", nil, &addr)
+	if err := s.Err(); err != nil && ctx.Err() == nil {
+		level.Debug(srv.logger).Log("err", err)
+	}
+}
+
+func parseRequest(line []byte) (request, error) {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return req, fmt.Errorf("invalid request: %v", err)
+	}
+
+	if req.Version != protocolVersion {
+		return req, fmt.Errorf("unsupported protocol version %d, want %d", req.Version, protocolVersion)
+	}
+
+	return req, nil
+}
+
+// call hands req to the main loop and waits for its reply. A request taken
+// by the main loop is always answered, even if ctx is done meanwhile.
+func call(ctx context.Context, req request, reqChan chan<- request) response {
+	replyChan := make(chan reply, 1)
+	req.reply = replyChan
+
+	select {
+	case reqChan <- req:
+	case <-ctx.Done():
+		return errorResponse(errShuttingDown)
+	}
+
+	r := <-replyChan
+
+	if r.err != nil {
+		return errorResponse(r.err)
+	}
+
+	resp := response{Version: protocolVersion, Status: statusOK}
+	if r.result != nil {
+		result, err := json.Marshal(r.result)
+		if err != nil {
+			return errorResponse(fmt.Errorf("error marshaling result: %v", err))
+		}
+
+		resp.Result = result
+	}
+
+	return resp
+}
+
+func errorResponse(err error) response {
+	return response{
+		Version: protocolVersion,
+		Status:  statusError,
+		Error:   err.Error(),
+	}
+}
+
+func parseConID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected a single con_id, got %q", args)
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid con_id %q", args[0])
+	}
+
+	return id, nil
+}
+
+// parseDepth parses the optional MRU position argument of switch. It returns
+// 0 without one, which lets switch cycle.
+func parseDepth(args []string) (int, error) {
+	switch len(args) {
+	case 0:
+		return 0, nil
+	case 1:
+	default:
+		return 0, fmt.Errorf("expected at most one position, got %q", args)
+	}
+
+	depth, err := strconv.Atoi(args[0])
+	if err != nil || depth < 1 {
+		return 0, fmt.Errorf("invalid position %q", args[0])
+	}
+
+	return depth, nil
+}
+
+// parseSwitch parses the position and the options of a switch request.
+func parseSwitch(req request) (focus.SwitchRequest, error) {
+	pos, err := parseDepth(req.Args)
 	if err != nil {
-		return err
+		return focus.SwitchRequest{}, err
+	}
+
+	sreq := focus.SwitchRequest{Position: pos}
+	for name, value := range req.Options {
+		switch name {
+		case "strategy":
+			if sreq.Strategy, err = focus.NewStrategy(value); err != nil {
+				return focus.SwitchRequest{}, err
+			}
+		case "same-class":
+			if sreq.SameClass, err = strconv.ParseBool(value); err != nil {
+				return focus.SwitchRequest{}, fmt.Errorf("invalid value %q of same-class", value)
+			}
+		case "prefer-urgent":
+			if sreq.PreferUrgent, err = strconv.ParseBool(value); err != nil {
+				return focus.SwitchRequest{}, fmt.Errorf("invalid value %q of prefer-urgent", value)
+			}
+		case "dry-run":
+			if sreq.DryRun, err = strconv.ParseBool(value); err != nil {
+				return focus.SwitchRequest{}, fmt.Errorf("invalid value %q of dry-run", value)
+			}
+		default:
+			return focus.SwitchRequest{}, fmt.Errorf("unknown option %q", name)
+		}
+	}
+
+	return sreq, nil
+}
+
+// remoteCommand sends a command to the daemon and returns the result of a
+// successful response.
+func remoteCommand(addr *net.UnixAddr, command string, args ...string) (json.RawMessage, error) {
+	return remoteRequest(addr, request{Version: protocolVersion, Command: command, Args: args})
+}
+
+func remoteRequest(addr *net.UnixAddr, req request) (json.RawMessage, error) {
+	conn, err := net.DialUnix("unix", nil, addr)
+	if err != nil {
+		return nil, err
 	}
 	defer conn.Close()
 
-	if _, err := conn.Write([]byte{'s'}); err != nil {
-		return err
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
 	}
 
-	return nil
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+
+	if resp.Status != statusOK {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.Result, nil
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	reqChan := make(chan request)
+	go func() {
+		for req := range reqChan {
+			switch req.Command {
+			case "list":
+				req.reply <- reply{result: []int{1, 2}}
+			default:
+				req.reply <- reply{err: errors.New("unknown command")}
+			}
+		}
+	}()
+	defer close(reqChan)
+
+	for _, tc := range []struct {
+		line string
+		want response
+	}{
+		{
+			line: `{"version":1,"command":"list"}`,
+			want: response{Version: 1, Status: statusOK, Result: []byte(`[1,2]`)},
+		},
+		{
+			line: `{"version":1,"command":"bogus"}`,
+			want: response{Version: 1, Status: statusError, Error: "unknown command"},
+		},
+		{
+			line: `{"version":2,"command":"list"}`,
+			want: response{Version: 1, Status: statusError, Error: "unsupported protocol version 2, want 1"},
+		},
+		{
+			line: `s`,
+			want: response{Version: 1, Status: statusError, Error: "invalid request: invalid character 's' looking for beginning of value"},
+		},
+	} {
+		var got response
+		if req, err := parseRequest([]byte(tc.line)); err != nil {
+			got = errorResponse(err)
+		} else {
+			got = call(context.Background(), req, reqChan)
+		}
+
+		if got.Status != tc.want.Status || got.Error != tc.want.Error || string(got.Result) != string(tc.want.Result) {
+			t.Errorf("%s: got %+v, want %+v", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestCallShuttingDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// nobody receives the request once the main loop stopped
+	got := call(ctx, request{Version: protocolVersion, Command: "list"}, make(chan request))
+	if got.Status != statusError || got.Error != errShuttingDown.Error() {
+		t.Errorf("got %+v, want error %q", got, errShuttingDown)
+	}
+}
+
+func TestParseSwitch(t *testing.T) {
+	for _, tc := range []struct {
+		req request
+		pos int
+		err string
+	}{
+		{req: request{}, pos: 0},
+		{req: request{Args: []string{"2"}, Options: map[string]string{"strategy": "frecency"}}, pos: 2},
+		{req: request{Args: []string{"0"}}, err: `invalid position "0"`},
+		{req: request{Options: map[string]string{"strategy": "lru"}}, err: `unknown strategy "lru"`},
+		{req: request{Options: map[string]string{"class": "URxvt"}}, err: `unknown option "class"`},
+		{req: request{Options: map[string]string{"same-class": "yes"}}, err: `invalid value "yes" of same-class`},
+		{req: request{Options: map[string]string{"prefer-urgent": "true", "same-class": "false"}}, pos: 0},
+		{req: request{Options: map[string]string{"dry-run": "maybe"}}, err: `invalid value "maybe" of dry-run`},
+	} {
+		sreq, err := parseSwitch(tc.req)
+		switch {
+		case tc.err != "":
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%+v: got error %v, want %q", tc.req, err, tc.err)
+			}
+		case err != nil:
+			t.Errorf("%+v: unexpected error %v", tc.req, err)
+		case sreq.Position != tc.pos:
+			t.Errorf("%+v: got position %d, want %d", tc.req, sreq.Position, tc.pos)
+		}
+	}
+}
+
+func TestListenRuntimeSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i3-focus-last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+	addr, err := socketAddr("/run/user/1000/i3/ipc-socket.1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other, _ := socketAddr("/run/user/1000/i3/ipc-socket.2", true); other.Name == addr.Name {
+		t.Errorf("two i3 instances share the socket %s", addr.Name)
+	}
+
+	l, err := listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(addr.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("got mode %o, want 0600", mode)
+	}
+
+	if _, err := listen(addr); err != errAlreadyRunning {
+		t.Errorf("listening twice on the same socket: got %v, want %v", err, errAlreadyRunning)
+	}
+
+	client, err := net.DialUnix("unix", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := l.AcceptUnix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := checkPeer(conn); err != nil {
+		t.Error(err)
+	}
+}
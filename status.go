@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/s-urbaniak/i3-focus-last/i3"
+)
+
+// recentEvents is the number of events kept for the status.
+const recentEvents = 20
+
+// status is the result of the status command and what the daemon logs on
+// SIGUSR1.
+type status struct {
+	Version     string                `json:"version"`
+	I3Version   string                `json:"i3_version"`
+	PID         int                   `json:"pid"`
+	Uptime      string                `json:"uptime"`
+	Current     int                   `json:"current"`
+	History     []window              `json:"history"`
+	Urgent      []int                 `json:"urgent"`
+	Cycle       cycleStatus           `json:"cycle"`
+	Connections map[string]connStatus `json:"connections"`
+	Events      []eventRecord         `json:"events"`
+}
+
+type cycleStatus struct {
+	Depth  int    `json:"depth"`
+	Target int    `json:"target"`
+	Since  string `json:"since,omitempty"`
+}
+
+type connStatus struct {
+	Connected  bool   `json:"connected"`
+	Reconnects int    `json:"reconnects"`
+	LastError  string `json:"last_error,omitempty"`
+	ErrorSince string `json:"error_since,omitempty"`
+}
+
+// eventRecord is what is kept of an i3 event. It leaves out window titles.
+type eventRecord struct {
+	Time   string `json:"time"`
+	Type   string `json:"type"`
+	Change string `json:"change"`
+	ID     int    `json:"con_id,omitempty"`
+	Class  string `json:"class,omitempty"`
+}
+
+// connHealth tracks the failures of a connection reported to its taker.
+type connHealth struct {
+	mu sync.Mutex
+	connStatus
+	// lost is called with the error which broke the connection, before it
+	// is reestablished.
+	lost func(error)
+}
+
+// wrap records the errors passed to take as well as take failing itself.
+func (h *connHealth) wrap(take connTaker) connTaker {
+	return func(err error) (net.Conn, error) {
+		if err != nil {
+			h.failed(err)
+			if h.lost != nil {
+				h.lost(err)
+			}
+		}
+
+		conn, takeErr := take(err)
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if takeErr != nil {
+			h.Connected = false
+			h.LastError = takeErr.Error()
+			return nil, takeErr
+		}
+
+		if err != nil {
+			h.Reconnects++
+		}
+		h.Connected = true
+
+		return conn, nil
+	}
+}
+
+func (h *connHealth) failed(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.Connected = false
+	h.LastError = err.Error()
+	h.ErrorSince = time.Now().Format(time.RFC3339)
+}
+
+func (h *connHealth) status() connStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.connStatus
+}
+
+func (d *daemon) recordEvent(typ i3.EventType, change string, n *i3.Node) {
+	// the marks written by the daemon would push out the events telling
+	// how focus moved
+	if typ == i3.EventWindow && change == "mark" {
+		return
+	}
+
+	if len(d.events) == recentEvents {
+		d.events = d.events[1:]
+	}
+
+	d.events = append(d.events, eventRecord{
+		Time:   time.Now().Format(time.RFC3339Nano),
+		Type:   typ.String(),
+		Change: change,
+		ID:     n.ID,
+		Class:  n.WindowProperties.Class,
+	})
+}
+
+func (d *daemon) status() status {
+	cycle := d.t.Cycle()
+	s := status{
+		Version: version,
+		PID:     os.Getpid(),
+		Uptime:  time.Since(d.started).Round(time.Second).String(),
+		Current: d.t.Current(),
+		Urgent:  append([]int{}, d.t.Urgent()...),
+		Cycle: cycleStatus{
+			Depth:  cycle.Depth,
+			Target: cycle.Target,
+		},
+		Connections: map[string]connStatus{
+			"events":   d.evHealth.status(),
+			"commands": d.cmdHealth.status(),
+		},
+		Events: append([]eventRecord{}, d.events...),
+	}
+
+	if !cycle.At.IsZero() {
+		s.Cycle.Since = cycle.At.Format(time.RFC3339Nano)
+	}
+
+	if err := withClient(d.cmdTaker, func(c *i3.Client) error {
+		v, err := c.Version()
+		if err != nil {
+			return err
+		}
+
+		s.I3Version = v.HumanReadable
+		return nil
+	}); err != nil {
+		s.I3Version = fmt.Sprintf("unknown: %v", err)
+	}
+
+	history := d.t.Windows()
+	list, err := listWindows(history, d.cmdTaker)
+	if err != nil {
+		// without the tree there is no metadata, but the IDs are still useful
+		for _, w := range history {
+			list = append(list, window{ID: w.ID, Cause: w.Cause})
+		}
+	}
+	s.History = list
+
+	return s
+}
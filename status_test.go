@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestConnHealth(t *testing.T) {
+	var (
+		h       connHealth
+		takeErr error
+	)
+
+	var lost []error
+	h.lost = func(err error) {
+		lost = append(lost, err)
+	}
+
+	take := h.wrap(func(error) (net.Conn, error) {
+		return nil, takeErr
+	})
+
+	take(nil)
+	if s := h.status(); !s.Connected || s.Reconnects != 0 {
+		t.Errorf("after first take: got %+v", s)
+	}
+
+	take(errors.New("broken pipe"))
+	if s := h.status(); !s.Connected || s.Reconnects != 1 || s.LastError != "broken pipe" {
+		t.Errorf("after reconnect: got %+v", s)
+	}
+
+	if len(lost) != 1 || lost[0].Error() != "broken pipe" {
+		t.Errorf("after reconnect: got lost %v", lost)
+	}
+
+	takeErr = errors.New("taking connection timed out")
+	take(nil)
+	if s := h.status(); s.Connected || s.LastError != takeErr.Error() {
+		t.Errorf("after failed take: got %+v", s)
+	}
+}
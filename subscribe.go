@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is the number of notifications queued for a subscriber.
+// Subscribers falling further behind are dropped.
+const subscriberBuffer = 32
+
+// notification is streamed to subscribers on every change of the history.
+type notification struct {
+	// Change is one of "focus", "remove", "switch", "restore", "cycle" or
+	// "urgent".
+	Change string `json:"change"`
+	ID     int    `json:"con_id,omitempty"`
+	// Position is the history position a switch went to.
+	Position int   `json:"position,omitempty"`
+	History  []int `json:"history"`
+}
+
+// broker fans out notifications without ever blocking the publisher.
+type broker struct {
+	mu sync.Mutex
+	// subs maps the channel of every subscriber to the function called
+	// when it is dropped, if any.
+	subs map[chan notification]func()
+}
+
+func newBroker() *broker {
+	return &broker{subs: make(map[chan notification]func())}
+}
+
+// subscribe returns the channel of a new subscriber. dropped is called, if
+// not nil, when the subscriber is dropped for being too slow. It must not
+// block.
+func (b *broker) subscribe(dropped func()) chan notification {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan notification, subscriberBuffer)
+	b.subs[ch] = dropped
+	return ch
+}
+
+func (b *broker) unsubscribe(ch chan notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *broker) publish(n notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch, dropped := range b.subs {
+		select {
+		case ch <- n:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+			if dropped != nil {
+				dropped()
+			}
+		}
+	}
+}
+
+// stream acknowledges a subscribe request and writes notifications to conn
+// until the subscriber goes away or is dropped, or ctx is done.
+func stream(ctx context.Context, conn net.Conn, b *broker) error {
+	// a subscriber which stopped reading blocks the write, until the
+	// deadline releases it
+	ch := b.subscribe(func() {
+		conn.SetWriteDeadline(time.Now())
+	})
+	defer b.unsubscribe(ch)
+
+	enc := json.NewEncoder(conn)
+	if err := enc.Encode(response{Version: protocolVersion, Status: statusOK}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case n, ok := <-ch:
+			if !ok {
+				return errors.New("subscriber too slow, dropped")
+			}
+
+			if err := enc.Encode(n); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// remoteSubscribe calls f with every notification sent by the daemon.
+func remoteSubscribe(addr *net.UnixAddr, f func(notification) error) error {
+	conn, err := net.DialUnix("unix", nil, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req := request{Version: protocolVersion, Command: "subscribe"}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+
+	s := bufio.NewScanner(conn)
+	if !s.Scan() {
+		return fmt.Errorf("error reading response: %v", s.Err())
+	}
+
+	var resp response
+	if err := json.Unmarshal(s.Bytes(), &resp); err != nil {
+		return fmt.Errorf("error reading response: %v", err)
+	}
+
+	if resp.Status != statusOK {
+		return errors.New(resp.Error)
+	}
+
+	for s.Scan() {
+		var n notification
+		if err := json.Unmarshal(s.Bytes(), &n); err != nil {
+			return fmt.Errorf("error reading notification: %v", err)
+		}
+
+		if err := f(n); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	return errors.New("daemon closed the connection")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	b := newBroker()
+	dropped := 0
+	slow, fast := b.subscribe(func() { dropped++ }), b.subscribe(nil)
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.publish(notification{Change: "focus", ID: i})
+		<-fast
+	}
+
+	n := 0
+	for range slow {
+		n++
+	}
+
+	if n != subscriberBuffer || dropped != 1 {
+		t.Errorf("slow subscriber got %d notifications and was dropped %d times, want %d and 1", n, dropped, subscriberBuffer)
+	}
+
+	b.publish(notification{Change: "focus"})
+	if _, ok := <-fast; !ok {
+		t.Error("fast subscriber was dropped")
+	}
+
+	b.unsubscribe(slow)
+	b.unsubscribe(fast)
+}
+
+func TestStalledSubscriber(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i3-focus-last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(dir, "socket"), Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// notifications big enough to fill the socket buffers in a few writes
+	big := notification{Change: "focus", History: make([]int, 100000)}
+
+	for _, tc := range []struct {
+		name     string
+		shutdown bool
+	}{
+		{name: "shutdown", shutdown: true},
+		{name: "dropped"},
+	} {
+		client, err := net.DialUnix("unix", nil, l.Addr().(*net.UnixAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv := &server{b: newBroker(), logger: log.NewNopLogger()}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			srv.handle(ctx, conn)
+			close(done)
+		}()
+
+		// the client subscribes and never reads
+		if _, err := fmt.Fprintln(client, `{"version":1,"command":"subscribe"}`); err != nil {
+			t.Fatal(err)
+		}
+
+		for subscribed := false; !subscribed; time.Sleep(time.Millisecond) {
+			srv.b.mu.Lock()
+			subscribed = len(srv.b.subs) == 1
+			srv.b.mu.Unlock()
+		}
+
+		timeout := time.After(5 * time.Second)
+		if tc.shutdown {
+			for i := 0; i < subscriberBuffer/2; i++ {
+				srv.b.publish(big)
+			}
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}
+
+	wait:
+		for {
+			select {
+			case <-done:
+				break wait
+			case <-timeout:
+				t.Fatalf("%s: handle blocks on a subscriber which does not read", tc.name)
+			default:
+			}
+
+			if !tc.shutdown {
+				srv.b.publish(big)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		cancel()
+		client.Close()
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// notifier sends state changes to systemd, see sd_notify(3). It does nothing
+// if the daemon was not started by systemd with Type=notify.
+type notifier struct {
+	addr *net.UnixAddr
+}
+
+func newNotifier() *notifier {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return &notifier{}
+	}
+
+	// abstract sockets are given with a leading @
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+
+	return &notifier{addr: &net.UnixAddr{Name: path, Net: "unixgram"}}
+}
+
+func (n *notifier) notify(state string) error {
+	if n.addr == nil {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+func (n *notifier) ready(status string) error {
+	return n.notify("READY=1\nSTATUS=" + status)
+}
+
+func (n *notifier) status(status string) error {
+	return n.notify("STATUS=" + status)
+}
+
+func (n *notifier) stopping() error {
+	return n.notify("STOPPING=1")
+}
+
+func (n *notifier) watchdog() error {
+	return n.notify("WATCHDOG=1")
+}
+
+// watchdogInterval returns how often keepalives have to be sent, which is
+// half of the watchdog timeout configured with WatchdogSec=, or 0 if the
+// watchdog is disabled.
+func watchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", usec)
+	}
+
+	return time.Duration(n) * time.Microsecond / 2, nil
+}
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+const listenFDsStart = 3
+
+// activationListener returns the control socket passed by systemd socket
+// activation, see sd_listen_fds(3), or nil if there is none.
+func activationListener() (*net.UnixListener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	if fds := os.Getenv("LISTEN_FDS"); fds != "1" {
+		return nil, fmt.Errorf("expected a single socket from systemd, got LISTEN_FDS=%q", fds)
+	}
+
+	syscall.CloseOnExec(listenFDsStart)
+	f := os.NewFile(listenFDsStart, "LISTEN_FD_3")
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+
+	ul, ok := l.(*net.UnixListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("socket from systemd is not a unix stream socket but %s", l.Addr().Network())
+	}
+
+	return ul, nil
+}
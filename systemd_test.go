@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i3-focus-last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := &net.UnixAddr{Name: filepath.Join(dir, "notify"), Net: "unixgram"}
+	sock, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sock.Close()
+
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	os.Setenv("NOTIFY_SOCKET", addr.Name)
+
+	n := newNotifier()
+	for _, tc := range []struct {
+		send func() error
+		want string
+	}{
+		{send: func() error { return n.ready("tracking 1 window") }, want: "READY=1\nSTATUS=tracking 1 window"},
+		{send: n.watchdog, want: "WATCHDOG=1"},
+		{send: func() error { return n.status("reconnecting") }, want: "STATUS=reconnecting"},
+	} {
+		if err := tc.send(); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 256)
+		sock.SetReadDeadline(time.Now().Add(time.Second))
+		l, err := sock.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := string(buf[:l]); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+
+	os.Unsetenv("NOTIFY_SOCKET")
+	if err := newNotifier().ready(""); err != nil {
+		t.Errorf("notifying without NOTIFY_SOCKET: %v", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	for _, tc := range []struct {
+		usec, pid string
+		want      time.Duration
+		fails     bool
+	}{
+		{want: 0},
+		{usec: "30000000", want: 15 * time.Second},
+		{usec: "30000000", pid: strconv.Itoa(os.Getpid()), want: 15 * time.Second},
+		{usec: "30000000", pid: "1", want: 0},
+		{usec: "soon", fails: true},
+	} {
+		os.Setenv("WATCHDOG_USEC", tc.usec)
+		os.Setenv("WATCHDOG_PID", tc.pid)
+
+		got, err := watchdogInterval()
+		if (err != nil) != tc.fails || got != tc.want {
+			t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: got %v, %v", tc.usec, tc.pid, got, err)
+		}
+	}
+}